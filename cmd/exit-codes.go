@@ -0,0 +1,22 @@
+package cmd
+
+const (
+	ExitSuccess        = 0
+	ExitFailure        = 1
+	ExitRootFailed     = 2
+	ExitPartialFailure = 3
+)
+
+// ExitError is returned from the command when the process should exit with specific code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (this *ExitError) Error() string {
+	return this.Err.Error()
+}
+
+func (this *ExitError) Unwrap() error {
+	return this.Err
+}
@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -10,6 +14,7 @@ import (
 	"github.com/PatrikValkovic/scrappy/internal/cliflags"
 	"github.com/PatrikValkovic/scrappy/internal/config"
 	"github.com/PatrikValkovic/scrappy/internal/logger"
+	"github.com/PatrikValkovic/scrappy/pkg/scrappy"
 )
 
 var RootCmd = &cobra.Command{
@@ -37,22 +42,71 @@ var RootCmd = &cobra.Command{
 
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		logger := logger.CreateLogger()
+		defer func() {
+			_ = logger.Sync()
+		}()
 		args, err := config.New()
 		if err != nil {
 			logger.Infof("Error: %v", err)
 			return err
 		}
-		return startMainLoop(&args, logger)
+		crawler, err := scrappy.New(args, logger)
+		if err != nil {
+			logger.Infof("Error: %v", err)
+			return err
+		}
+		interruptCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		err = crawler.Run(interruptCtx)
+		if err == nil {
+			return nil
+		}
+		logger.Errorf("Error: %v", err)
+		switch {
+		case errors.Is(err, scrappy.ErrRootFailed):
+			return &ExitError{Code: ExitRootFailed, Err: err}
+		case errors.Is(err, scrappy.ErrPartialFailure):
+			return &ExitError{Code: ExitPartialFailure, Err: err}
+		default:
+			return &ExitError{Code: ExitFailure, Err: err}
+		}
 	},
 }
 
 func init() {
-	RootCmd.PersistentFlags().Int(cliflags.MaxDepth, 20, "Maximum depth of the crawling")
+	defaults := config.Default()
+	RootCmd.PersistentFlags().Uint64(cliflags.MaxDepth, defaults.MaxDepth, "Maximum depth of the crawling")
 	RootCmd.PersistentFlags().String(cliflags.ParseRoot, "", "Where to start parsing")
-	RootCmd.PersistentFlags().String(cliflags.OutputDir, "./scrapes", "Where to store downloaded files")
+	RootCmd.PersistentFlags().String(cliflags.OutputDir, defaults.OutputDir, "Where to store downloaded files")
 	RootCmd.PersistentFlags().String(cliflags.RequiredPrefix, "", "Prefix that all the links must have")
-	RootCmd.PersistentFlags().String(cliflags.Environment, "production", "Prefix that all the links must have")
-	RootCmd.PersistentFlags().Uint(cliflags.DownloadConcurrency, 4, "Maximum number of files to download in parallel")
-	RootCmd.PersistentFlags().Uint(cliflags.ParseConcurrency, 2, "Maximum number of files to parse in parallel")
+	RootCmd.PersistentFlags().String(cliflags.Environment, defaults.Environment, "Prefix that all the links must have")
+	RootCmd.PersistentFlags().Uint32(cliflags.DownloadConcurrency, defaults.DownloadConcurrency, "Maximum number of files to download in parallel")
+	RootCmd.PersistentFlags().Uint32(cliflags.ParseConcurrency, defaults.ParseConcurrency, "Maximum number of files to parse in parallel")
 	RootCmd.PersistentFlags().StringArray(cliflags.IgnorePattern, []string{}, "Pattern to ignore, may be specified multiple times")
+	RootCmd.PersistentFlags().Duration(cliflags.ConnectTimeout, defaults.ConnectTimeout, "Maximum time to establish a connection")
+	RootCmd.PersistentFlags().Duration(cliflags.ReadTimeout, defaults.ReadTimeout, "Maximum time to wait for response headers or the next part of the body")
+	RootCmd.PersistentFlags().Duration(cliflags.RequestTimeout, defaults.RequestTimeout, "Maximum total time of a single download, files streamed to disk are limited only by read-timeout")
+	RootCmd.PersistentFlags().String(cliflags.UserAgent, defaults.UserAgent, "User-Agent sent with every request")
+	RootCmd.PersistentFlags().StringArray(cliflags.Header, []string{}, "Extra header in form \"Name: value\", may be specified multiple times")
+	RootCmd.PersistentFlags().StringArray(cliflags.HostHeader, []string{}, "Extra header for a single host in form \"host=Name: value\", may be specified multiple times")
+	RootCmd.PersistentFlags().Uint32(cliflags.MaxAttempts, defaults.MaxAttempts, "Maximum number of attempts for a single download")
+	RootCmd.PersistentFlags().Duration(cliflags.RetryDelay, defaults.RetryDelay, "Initial delay between download attempts, doubled after every failure")
+	RootCmd.PersistentFlags().Duration(cliflags.RetryMaxDelay, defaults.RetryMaxDelay, "Maximum delay between download attempts")
+	RootCmd.PersistentFlags().StringArray(cliflags.IgnoreRobots, []string{}, "Host for which robots.txt is not respected, \"*\" for all hosts, may be specified multiple times")
+	RootCmd.PersistentFlags().Uint32(cliflags.HostConcurrency, defaults.HostDefaultLimit.Concurrency, "Maximum number of parallel downloads from a single host, 0 for unlimited")
+	RootCmd.PersistentFlags().Duration(cliflags.HostDelay, defaults.HostDefaultLimit.Delay, "Minimum delay between requests to a single host")
+	RootCmd.PersistentFlags().StringArray(cliflags.HostLimit, []string{}, "Limit for hosts matching pattern in form \"pattern=concurrency:N,delay:D,rps:R\", may be specified multiple times")
+	RootCmd.PersistentFlags().Bool(cliflags.Resume, false, "Continue the crawl from the state saved in the output directory")
+	RootCmd.PersistentFlags().Duration(cliflags.CheckpointInterval, defaults.CheckpointInterval, "How often to save the crawl state, 0 to save only at the end")
+	RootCmd.PersistentFlags().Bool(cliflags.ConditionalRequests, defaults.ConditionalRequests, "Send If-None-Match/If-Modified-Since based on the previous crawl and reuse not modified files")
+	RootCmd.PersistentFlags().String(cliflags.SrcsetMode, defaults.SrcsetMode, "Which srcset candidates to download, \"all\" or \"largest\"")
+	RootCmd.PersistentFlags().String(cliflags.Layout, defaults.Layout, "Output layout, \"flat\", \"tree\" or \"tree-host\"")
+	RootCmd.PersistentFlags().StringArray(cliflags.IgnoreQueryParam, defaults.IgnoreQueryParams, "Query parameter (glob pattern) removed from urls, may be specified multiple times")
+	RootCmd.PersistentFlags().Bool(cliflags.Canonicalize, defaults.Canonicalize, "Lowercase scheme and host, drop default ports, resolve dot segments and sort query parameters of urls")
+	RootCmd.PersistentFlags().Bool(cliflags.FoldTrailingSlash, defaults.FoldTrailingSlash, "Treat urls differing only by trailing slash as the same page")
+	RootCmd.PersistentFlags().StringArray(cliflags.BinaryType, defaults.BinaryTypes, "Content type (glob pattern) without parser that is stored as it is, may be specified multiple times")
+	RootCmd.PersistentFlags().StringArray(cliflags.ExcludeBinaryType, defaults.ExcludeBinaryTypes, "Content type (glob pattern) that is not downloaded, links to it keep the original url, may be specified multiple times")
+	RootCmd.PersistentFlags().String(cliflags.MissingPlaceholder, "", "Page relative to the output directory that links to not downloaded files lead to, original urls are used when empty")
+	RootCmd.PersistentFlags().StringArray(cliflags.MaxSize, []string{}, "Maximum response size for content types matching pattern in form \"pattern=size\", e.g. \"video/*=500MB\", may be specified multiple times")
+	RootCmd.PersistentFlags().String(cliflags.SniffContentType, defaults.SniffPolicy, "When the content type detected from the content overrides the header, \"never\", \"missing\", \"generic\" or \"always\"")
 }
@@ -9,6 +9,8 @@ require (
 	github.com/spf13/viper v1.15.0
 	github.com/tdewolff/parse v2.3.4+incompatible
 	go.uber.org/zap v1.27.0
+	golang.org/x/net v0.7.0
+	golang.org/x/text v0.7.0
 )
 
 require (
@@ -27,9 +29,7 @@ require (
 	github.com/tdewolff/test v1.0.7 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	golang.org/x/net v0.7.0 // indirect
 	golang.org/x/sys v0.5.0 // indirect
-	golang.org/x/text v0.7.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,95 @@
+package canonical
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalizer normalizes urls, so that equivalent urls are downloaded and stored only once.
+type Canonicalizer struct {
+	// Enabled lowercases scheme and host, drops default ports, resolves dot segments and sorts query parameters.
+	Enabled bool
+	// IgnoredQueryParams are path.Match patterns of query parameters removed from urls, e.g. "utm_*".
+	IgnoredQueryParams []string
+	// FoldTrailingSlash makes /docs/ and /docs the same page for de-duplication.
+	FoldTrailingSlash bool
+}
+
+func New(args *config.Config) *Canonicalizer {
+	return &Canonicalizer{
+		Enabled:            args.Canonicalize,
+		IgnoredQueryParams: args.IgnoreQueryParams,
+		FoldTrailingSlash:  args.FoldTrailingSlash,
+	}
+}
+
+// Url returns url that should be downloaded, the fragment is preserved.
+func (this *Canonicalizer) Url(link url.URL) url.URL {
+	link.RawQuery = this.query(link.RawQuery)
+	if !this.Enabled {
+		return link
+	}
+
+	link.Scheme = strings.ToLower(link.Scheme)
+	link.Host = strings.ToLower(link.Host)
+	if port := link.Port(); port != "" && defaultPorts[link.Scheme] == port {
+		link.Host = strings.TrimSuffix(link.Host, ":"+port)
+	}
+	if link.Path == "" && link.Host != "" {
+		link.Path = "/"
+	}
+	if strings.Contains(link.Path, "/.") {
+		cleaned := path.Clean(link.Path)
+		if strings.HasSuffix(link.Path, "/") && cleaned != "/" {
+			cleaned = cleaned + "/"
+		}
+		link.Path = cleaned
+		link.RawPath = ""
+	}
+	link.ForceQuery = false
+	return link
+}
+
+// Key identifies the url for de-duplication and mapping to local files.
+func (this *Canonicalizer) Key(link url.URL) string {
+	link = this.Url(link)
+	link.Fragment = ""
+	link.RawFragment = ""
+	if this.FoldTrailingSlash && len(link.Path) > 1 && strings.HasSuffix(link.Path, "/") {
+		link.Path = strings.TrimSuffix(link.Path, "/")
+		link.RawPath = strings.TrimSuffix(link.RawPath, "/")
+	}
+	return link.String()
+}
+
+func (this *Canonicalizer) query(rawQuery string) string {
+	if rawQuery == "" || (!this.Enabled && len(this.IgnoredQueryParams) == 0) {
+		return rawQuery
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	removed := false
+	for name := range values {
+		for _, pattern := range this.IgnoredQueryParams {
+			if matched, _ := path.Match(pattern, name); matched {
+				values.Del(name)
+				removed = true
+				break
+			}
+		}
+	}
+	if !this.Enabled && !removed {
+		return rawQuery
+	}
+	return values.Encode()
+}
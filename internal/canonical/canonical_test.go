@@ -0,0 +1,69 @@
+package canonical
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalizerUrl(t *testing.T) {
+	enabled := &Canonicalizer{Enabled: true, IgnoredQueryParams: []string{"utm_*", "fbclid"}}
+	disabled := &Canonicalizer{Enabled: false, IgnoredQueryParams: []string{"utm_*"}}
+	tests := []struct {
+		canonicalizer *Canonicalizer
+		link          string
+		want          string
+	}{
+		{enabled, "HTTP://Example.COM/Docs/", "http://example.com/Docs/"},
+		{enabled, "http://example.com:80/page", "http://example.com/page"},
+		{enabled, "https://example.com:443/page", "https://example.com/page"},
+		{enabled, "https://example.com:80/page", "https://example.com:80/page"},
+		{enabled, "http://example.com", "http://example.com/"},
+		{enabled, "http://example.com/a/./b/../c.html", "http://example.com/a/c.html"},
+		{enabled, "http://example.com/a/b/../", "http://example.com/a/"},
+		{enabled, "http://example.com/../../etc/", "http://example.com/etc/"},
+		{enabled, "http://example.com/page?b=2&a=1", "http://example.com/page?a=1&b=2"},
+		{enabled, "http://example.com/page?utm_source=x&id=1&fbclid=y", "http://example.com/page?id=1"},
+		{enabled, "http://example.com/page?utm_source=x", "http://example.com/page"},
+		{enabled, "http://example.com/page?", "http://example.com/page"},
+		{enabled, "http://example.com/page#Section", "http://example.com/page#Section"},
+		{disabled, "HTTP://Example.COM:80/a/../page?b=2&a=1", "http://Example.COM:80/a/../page?b=2&a=1"},
+		{disabled, "http://example.com/page?b=2&utm_source=x&a=1", "http://example.com/page?a=1&b=2"},
+	}
+	for _, test := range tests {
+		link, err := url.Parse(test.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := test.canonicalizer.Url(*link)
+		if got.String() != test.want {
+			t.Errorf("Url(%q) with Enabled=%v = %q, want %q", test.link, test.canonicalizer.Enabled, got.String(), test.want)
+		}
+	}
+}
+
+func TestCanonicalizerKey(t *testing.T) {
+	plain := &Canonicalizer{Enabled: true}
+	folding := &Canonicalizer{Enabled: true, FoldTrailingSlash: true}
+	tests := []struct {
+		canonicalizer *Canonicalizer
+		link          string
+		want          string
+	}{
+		{plain, "http://example.com/page#top", "http://example.com/page"},
+		{plain, "http://example.com/docs/", "http://example.com/docs/"},
+		{plain, "http://Example.com", "http://example.com/"},
+		{folding, "http://example.com/docs/", "http://example.com/docs"},
+		{folding, "http://example.com/docs", "http://example.com/docs"},
+		{folding, "http://example.com/", "http://example.com/"},
+		{folding, "http://example.com/docs/?page=1#top", "http://example.com/docs?page=1"},
+	}
+	for _, test := range tests {
+		link, err := url.Parse(test.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := test.canonicalizer.Key(*link); got != test.want {
+			t.Errorf("Key(%q) with FoldTrailingSlash=%v = %q, want %q", test.link, test.canonicalizer.FoldTrailingSlash, got, test.want)
+		}
+	}
+}
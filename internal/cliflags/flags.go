@@ -9,4 +9,30 @@ const (
 	DownloadConcurrency = "download-concurrency"
 	ParseConcurrency    = "parse-concurrency"
 	IgnorePattern       = "ignore-pattern"
+	ConnectTimeout      = "connect-timeout"
+	ReadTimeout         = "read-timeout"
+	RequestTimeout      = "request-timeout"
+	UserAgent           = "user-agent"
+	Header              = "header"
+	HostHeader          = "host-header"
+	MaxAttempts         = "max-attempts"
+	RetryDelay          = "retry-delay"
+	RetryMaxDelay       = "retry-max-delay"
+	IgnoreRobots        = "ignore-robots"
+	HostConcurrency     = "host-concurrency"
+	HostDelay           = "host-delay"
+	HostLimit           = "host-limit"
+	Resume              = "resume"
+	CheckpointInterval  = "checkpoint-interval"
+	ConditionalRequests = "conditional-requests"
+	SrcsetMode          = "srcset-mode"
+	Layout              = "layout"
+	IgnoreQueryParam    = "ignore-query-param"
+	Canonicalize        = "canonicalize"
+	FoldTrailingSlash   = "fold-trailing-slash"
+	BinaryType          = "binary-type"
+	ExcludeBinaryType   = "exclude-binary-type"
+	MissingPlaceholder  = "missing-placeholder"
+	MaxSize             = "max-size"
+	SniffContentType    = "sniff-content-type"
 )
@@ -4,12 +4,28 @@ import (
 	"errors"
 	"fmt"
 	"github.com/spf13/viper"
+	"path"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/PatrikValkovic/scrappy/internal/cliflags"
 	"github.com/PatrikValkovic/scrappy/internal/environment"
 )
 
+type HostLimit struct {
+	Pattern     string
+	Concurrency uint32
+	Delay       time.Duration
+}
+
+// SizeLimit is the maximum response size of content types matching the pattern.
+type SizeLimit struct {
+	Pattern string
+	Size    int64
+}
+
 type Config struct {
 	ParseRoot           string
 	OutputDir           string
@@ -19,6 +35,31 @@ type Config struct {
 	DownloadConcurrency uint32
 	ParseConcurrency    uint32
 	IgnorePatterns      []*regexp.Regexp
+	ConnectTimeout      time.Duration
+	ReadTimeout         time.Duration
+	RequestTimeout      time.Duration
+	UserAgent           string
+	Headers             map[string]string
+	HostHeaders         map[string]map[string]string
+	MaxAttempts         uint32
+	RetryDelay          time.Duration
+	RetryMaxDelay       time.Duration
+	IgnoreRobots        []string
+	HostDefaultLimit    HostLimit
+	HostLimits          []HostLimit
+	Resume              bool
+	CheckpointInterval  time.Duration
+	ConditionalRequests bool
+	SrcsetMode          string
+	Layout              string
+	IgnoreQueryParams   []string
+	Canonicalize        bool
+	FoldTrailingSlash   bool
+	BinaryTypes         []string
+	ExcludeBinaryTypes  []string
+	MissingPlaceholder  string
+	MaxSizes            []SizeLimit
+	SniffPolicy         string
 }
 
 func New() (Config, error) {
@@ -26,7 +67,6 @@ func New() (Config, error) {
 	outputDir := viper.GetString(cliflags.OutputDir)
 	maxDepth := viper.GetUint64(cliflags.MaxDepth)
 	requiredPrefix := viper.GetString(cliflags.RequiredPrefix)
-	fmt.Printf("Parse root: %v\n", viper.AllSettings())
 
 	if parseRoot == "" {
 		return Config{}, errors.New("Missing parse root")
@@ -51,7 +91,63 @@ func New() (Config, error) {
 		ignoreRegexes = append(ignoreRegexes, regex)
 	}
 
-	return Config{
+	headers := make(map[string]string)
+	for _, header := range viper.GetStringSlice(cliflags.Header) {
+		name, value, err := parseHeader(header)
+		if err != nil {
+			return Config{}, err
+		}
+		headers[name] = value
+	}
+
+	hostHeaders := make(map[string]map[string]string)
+	for _, hostHeader := range viper.GetStringSlice(cliflags.HostHeader) {
+		host, header, found := strings.Cut(hostHeader, "=")
+		if !found || strings.TrimSpace(host) == "" {
+			return Config{}, fmt.Errorf("Invalid host header %s, expected host=Name: value", hostHeader)
+		}
+		name, value, err := parseHeader(header)
+		if err != nil {
+			return Config{}, err
+		}
+		host = strings.ToLower(strings.TrimSpace(host))
+		if hostHeaders[host] == nil {
+			hostHeaders[host] = make(map[string]string)
+		}
+		hostHeaders[host][name] = value
+	}
+
+	for _, pattern := range viper.GetStringSlice(cliflags.IgnoreQueryParam) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Config{}, fmt.Errorf("Invalid ignored query param pattern %s: %v", pattern, err)
+		}
+	}
+
+	for _, pattern := range append(viper.GetStringSlice(cliflags.BinaryType), viper.GetStringSlice(cliflags.ExcludeBinaryType)...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Config{}, fmt.Errorf("Invalid binary type pattern %s: %v", pattern, err)
+		}
+	}
+
+	hostLimits := make([]HostLimit, 0)
+	for _, hostLimit := range viper.GetStringSlice(cliflags.HostLimit) {
+		limit, err := parseHostLimit(hostLimit)
+		if err != nil {
+			return Config{}, err
+		}
+		hostLimits = append(hostLimits, limit)
+	}
+
+	maxSizes := make([]SizeLimit, 0)
+	for _, maxSize := range viper.GetStringSlice(cliflags.MaxSize) {
+		limit, err := parseSizeLimit(maxSize)
+		if err != nil {
+			return Config{}, err
+		}
+		maxSizes = append(maxSizes, limit)
+	}
+
+	config := Config{
 		ParseRoot:           parseRoot,
 		OutputDir:           outputDir,
 		MaxDepth:            maxDepth,
@@ -60,5 +156,121 @@ func New() (Config, error) {
 		DownloadConcurrency: viper.GetUint32(cliflags.DownloadConcurrency),
 		ParseConcurrency:    viper.GetUint32(cliflags.ParseConcurrency),
 		IgnorePatterns:      ignoreRegexes,
-	}, nil
+		ConnectTimeout:      viper.GetDuration(cliflags.ConnectTimeout),
+		ReadTimeout:         viper.GetDuration(cliflags.ReadTimeout),
+		RequestTimeout:      viper.GetDuration(cliflags.RequestTimeout),
+		UserAgent:           viper.GetString(cliflags.UserAgent),
+		Headers:             headers,
+		HostHeaders:         hostHeaders,
+		MaxAttempts:         viper.GetUint32(cliflags.MaxAttempts),
+		RetryDelay:          viper.GetDuration(cliflags.RetryDelay),
+		RetryMaxDelay:       viper.GetDuration(cliflags.RetryMaxDelay),
+		IgnoreRobots:        viper.GetStringSlice(cliflags.IgnoreRobots),
+		HostDefaultLimit: HostLimit{
+			Pattern:     "*",
+			Concurrency: viper.GetUint32(cliflags.HostConcurrency),
+			Delay:       viper.GetDuration(cliflags.HostDelay),
+		},
+		HostLimits:          hostLimits,
+		Resume:              viper.GetBool(cliflags.Resume),
+		CheckpointInterval:  viper.GetDuration(cliflags.CheckpointInterval),
+		ConditionalRequests: viper.GetBool(cliflags.ConditionalRequests),
+		SrcsetMode:          viper.GetString(cliflags.SrcsetMode),
+		Layout:              viper.GetString(cliflags.Layout),
+		IgnoreQueryParams:   viper.GetStringSlice(cliflags.IgnoreQueryParam),
+		Canonicalize:        viper.GetBool(cliflags.Canonicalize),
+		FoldTrailingSlash:   viper.GetBool(cliflags.FoldTrailingSlash),
+		BinaryTypes:         viper.GetStringSlice(cliflags.BinaryType),
+		ExcludeBinaryTypes:  viper.GetStringSlice(cliflags.ExcludeBinaryType),
+		MissingPlaceholder:  viper.GetString(cliflags.MissingPlaceholder),
+		MaxSizes:            maxSizes,
+		SniffPolicy:         viper.GetString(cliflags.SniffContentType),
+	}
+	return config, config.Validate()
+}
+
+func parseHeader(header string) (string, string, error) {
+	name, value, found := strings.Cut(header, ":")
+	name = strings.TrimSpace(name)
+	if !found || name == "" {
+		return "", "", fmt.Errorf("Invalid header %s, expected Name: value", header)
+	}
+	return name, strings.TrimSpace(value), nil
+}
+
+// parseSizeLimit parses limit in form pattern=size, size may have suffix KB, MB or GB (multiples of 1024).
+func parseSizeLimit(sizeLimit string) (SizeLimit, error) {
+	pattern, size, found := strings.Cut(sizeLimit, "=")
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if !found || pattern == "" {
+		return SizeLimit{}, fmt.Errorf("Invalid max size %s, expected pattern=size", sizeLimit)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return SizeLimit{}, fmt.Errorf("Invalid max size pattern %s: %v", pattern, err)
+	}
+	size = strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(size, unit.suffix) {
+			size = strings.TrimSpace(strings.TrimSuffix(size, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || value < 0 {
+		return SizeLimit{}, fmt.Errorf("Invalid max size %s", sizeLimit)
+	}
+	return SizeLimit{Pattern: pattern, Size: value * multiplier}, nil
+}
+
+// parseHostLimit parses limit in form pattern=concurrency:2,delay:500ms,rps:4.
+func parseHostLimit(hostLimit string) (HostLimit, error) {
+	pattern, options, found := strings.Cut(hostLimit, "=")
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if !found || pattern == "" {
+		return HostLimit{}, fmt.Errorf("Invalid host limit %s, expected pattern=concurrency:N,delay:D,rps:R", hostLimit)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return HostLimit{}, fmt.Errorf("Invalid host limit pattern %s: %v", pattern, err)
+	}
+
+	limit := HostLimit{Pattern: pattern}
+	for _, option := range strings.Split(options, ",") {
+		key, value, found := strings.Cut(option, ":")
+		if !found {
+			return HostLimit{}, fmt.Errorf("Invalid host limit option %s in %s", option, hostLimit)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "concurrency":
+			concurrency, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return HostLimit{}, fmt.Errorf("Invalid host limit concurrency %s: %v", value, err)
+			}
+			limit.Concurrency = uint32(concurrency)
+		case "delay":
+			delay, err := time.ParseDuration(value)
+			if err != nil {
+				return HostLimit{}, fmt.Errorf("Invalid host limit delay %s: %v", value, err)
+			}
+			if delay > limit.Delay {
+				limit.Delay = delay
+			}
+		case "rps":
+			rps, err := strconv.ParseFloat(value, 64)
+			if err != nil || rps <= 0 {
+				return HostLimit{}, fmt.Errorf("Invalid host limit rps %s", value)
+			}
+			if delay := time.Duration(float64(time.Second) / rps); delay > limit.Delay {
+				limit.Delay = delay
+			}
+		default:
+			return HostLimit{}, fmt.Errorf("Unknown host limit option %s in %s", key, hostLimit)
+		}
+	}
+	return limit, nil
 }
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PatrikValkovic/scrappy/internal/environment"
+)
+
+const (
+	SrcsetAll     = "all"
+	SrcsetLargest = "largest"
+
+	LayoutFlat     = "flat"
+	LayoutTree     = "tree"
+	LayoutTreeHost = "tree-host"
+
+	SniffNever   = "never"
+	SniffMissing = "missing"
+	SniffGeneric = "generic"
+	SniffAlways  = "always"
+)
+
+// Default returns configuration with the same defaults as the command line flags.
+func Default() Config {
+	return Config{
+		OutputDir:           "./scrapes",
+		MaxDepth:            20,
+		Environment:         environment.Production,
+		DownloadConcurrency: 4,
+		ParseConcurrency:    2,
+		ConnectTimeout:      10 * time.Second,
+		ReadTimeout:         30 * time.Second,
+		RequestTimeout:      2 * time.Minute,
+		UserAgent:           "scrappy (+https://github.com/PatrikValkovic/scrappy)",
+		Headers:             map[string]string{},
+		HostHeaders:         map[string]map[string]string{},
+		MaxAttempts:         3,
+		RetryDelay:          time.Second,
+		RetryMaxDelay:       30 * time.Second,
+		HostDefaultLimit: HostLimit{
+			Pattern:     "*",
+			Concurrency: 2,
+		},
+		CheckpointInterval:  30 * time.Second,
+		ConditionalRequests: true,
+		SrcsetMode:          SrcsetAll,
+		Layout:              LayoutFlat,
+		IgnoreQueryParams:   []string{"utm_*", "fbclid", "gclid"},
+		Canonicalize:        true,
+		FoldTrailingSlash:   false,
+		BinaryTypes: []string{
+			"application/pdf",
+			"application/zip",
+			"application/gzip",
+			"application/octet-stream",
+			"application/msword",
+			"application/vnd.*",
+			"application/x-*",
+			"audio/*",
+			"text/plain",
+			"text/csv",
+		},
+		ExcludeBinaryTypes: []string{},
+		SniffPolicy:        SniffGeneric,
+	}
+}
+
+// Validate checks values that would prevent the crawl from running.
+func (this *Config) Validate() error {
+	if this.ParseRoot == "" {
+		return errors.New("Missing parse root")
+	}
+	if this.OutputDir == "" {
+		return errors.New("Missing output dir")
+	}
+	if this.DownloadConcurrency == 0 {
+		return errors.New("Download concurrency must be at least 1")
+	}
+	if this.ParseConcurrency == 0 {
+		return errors.New("Parse concurrency must be at least 1")
+	}
+	if this.MaxAttempts == 0 {
+		return errors.New("Max attempts must be at least 1")
+	}
+	if this.SrcsetMode != SrcsetAll && this.SrcsetMode != SrcsetLargest {
+		return fmt.Errorf("Invalid srcset mode %s, expected %s or %s", this.SrcsetMode, SrcsetAll, SrcsetLargest)
+	}
+	if this.Layout != LayoutFlat && this.Layout != LayoutTree && this.Layout != LayoutTreeHost {
+		return fmt.Errorf("Invalid layout %s, expected %s, %s or %s", this.Layout, LayoutFlat, LayoutTree, LayoutTreeHost)
+	}
+	if this.SniffPolicy != SniffNever && this.SniffPolicy != SniffMissing && this.SniffPolicy != SniffGeneric && this.SniffPolicy != SniffAlways {
+		return fmt.Errorf("Invalid sniff policy %s, expected %s, %s, %s or %s", this.SniffPolicy, SniffNever, SniffMissing, SniffGeneric, SniffAlways)
+	}
+	return nil
+}
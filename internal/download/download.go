@@ -1,45 +1,332 @@
 package download
 
 import (
+	"bufio"
+	"context"
 	"errors"
-	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+	"github.com/PatrikValkovic/scrappy/internal/sniff"
 )
 
+// TempPattern is the name pattern of temporary files of streamed downloads.
+const TempPattern = ".scrappy-download-*"
+
 type DownloadResult struct {
-	Url         url.URL
-	Content     []byte
-	ContentType string
+	// Url is the final url after redirects.
+	Url url.URL
+	// Redirects are urls that were redirected, starting with the requested one, empty without redirect.
+	Redirects []url.URL
+	// Content is nil when the content was streamed into TempFile.
+	Content      []byte
+	TempFile     string
+	ContentType  string
+	ETag         string
+	LastModified string
+	NotModified  bool
+}
+
+// Validators of previously downloaded content, zero value means unconditional request.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// StreamFunc decides whether the response is streamed into a temporary file instead of kept in memory.
+type StreamFunc func(location url.URL, contentType string) bool
+
+type Client struct {
+	Logger      *zap.SugaredLogger
+	UserAgent   string
+	Headers     map[string]string
+	HostHeaders map[string]map[string]string
+	Retry       RetryPolicy
+	// TempDir is the directory of streamed downloads.
+	TempDir string
+	// MaxSizes limits size of responses by content type, the first matching limit is used.
+	MaxSizes []config.SizeLimit
+	// Sniffer detects content type of responses with missing or wrong Content-Type header.
+	Sniffer *sniff.Sniffer
+	// Excluded decides whether the response is dropped before its body is read, nil keeps every response.
+	Excluded func(location url.URL, contentType string) bool
+	// ReadTimeout limits waiting for the next part of the body, zero disables it.
+	ReadTimeout time.Duration
+	// RequestTimeout limits the whole download, streamed bodies are limited only by ReadTimeout.
+	RequestTimeout time.Duration
+	client         *http.Client
+}
+
+func NewClient(args *config.Config, logger *zap.SugaredLogger) *Client {
+	dialer := &net.Dialer{
+		Timeout: args.ConnectTimeout,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = args.ConnectTimeout
+	transport.ResponseHeaderTimeout = args.ReadTimeout
+	return &Client{
+		Logger:      logger,
+		UserAgent:   args.UserAgent,
+		Headers:     args.Headers,
+		HostHeaders: args.HostHeaders,
+		Retry: RetryPolicy{
+			MaxAttempts: args.MaxAttempts,
+			BaseDelay:   args.RetryDelay,
+			MaxDelay:    args.RetryMaxDelay,
+		},
+		TempDir:        args.OutputDir,
+		MaxSizes:       args.MaxSizes,
+		Sniffer:        sniff.New(args.SniffPolicy),
+		ReadTimeout:    args.ReadTimeout,
+		RequestTimeout: args.RequestTimeout,
+		client: &http.Client{
+			Transport: transport,
+		},
+	}
+}
+
+func (this *Client) Download(ctx context.Context, url url.URL, validators Validators) (DownloadResult, error) {
+	return this.DownloadTo(ctx, url, validators, nil)
+}
+
+// DownloadTo downloads the url, responses accepted by stream are written into a temporary file in TempDir.
+func (this *Client) DownloadTo(ctx context.Context, url url.URL, validators Validators, stream StreamFunc) (DownloadResult, error) {
+	attempt := uint32(1)
+	for {
+		result, err := this.fetch(ctx, url, validators, stream)
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= this.Retry.MaxAttempts || !isRetryable(err) {
+			return DownloadResult{}, &AttemptsError{Attempts: attempt, Err: err}
+		}
+		delay, ok := this.Retry.delay(attempt, err)
+		if !ok {
+			this.Logger.Warnf("Server asked to retry %s in %v, which exceeds maximum retry delay %v", url.String(), delay, this.Retry.MaxDelay)
+			return DownloadResult{}, &AttemptsError{Attempts: attempt, Err: err}
+		}
+		this.Logger.Infof("Download of %s failed with %v, retrying in %v", url.String(), err, delay)
+		select {
+		case <-ctx.Done():
+			return DownloadResult{}, &AttemptsError{Attempts: attempt, Err: err}
+		case <-time.After(delay):
+		}
+		attempt++
+	}
 }
 
-func Download(url url.URL, logger *zap.SugaredLogger) (DownloadResult, error) {
-	resp, err := http.Get(url.String())
+// fetch makes single attempt, timeouts cancel the request and are reported as TimeoutError.
+func (this *Client) fetch(ctx context.Context, url url.URL, validators Validators, stream StreamFunc) (DownloadResult, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	total := time.AfterFunc(this.RequestTimeout, func() {
+		cancel(&TimeoutError{Timeout: this.RequestTimeout})
+	})
+	if this.RequestTimeout <= 0 {
+		total.Stop()
+	}
+	defer total.Stop()
+
+	result, err := this.fetchWithin(ctx, cancel, total, url, validators, stream)
+	var timeoutErr *TimeoutError
+	if err != nil && errors.As(context.Cause(ctx), &timeoutErr) {
+		return DownloadResult{}, timeoutErr
+	}
+	return result, err
+}
+
+func (this *Client) fetchWithin(
+	ctx context.Context,
+	cancel context.CancelCauseFunc,
+	total *time.Timer,
+	url url.URL,
+	validators Validators,
+	stream StreamFunc,
+) (DownloadResult, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return DownloadResult{}, err
+	}
+	if this.UserAgent != "" {
+		request.Header.Set("User-Agent", this.UserAgent)
+	}
+	for name, value := range this.Headers {
+		request.Header.Set(name, value)
+	}
+	for name, value := range this.HostHeaders[strings.ToLower(url.Hostname())] {
+		request.Header.Set(name, value)
+	}
+	if validators.ETag != "" {
+		request.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		request.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+
+	resp, err := this.client.Do(request)
 	if resp != nil {
 		defer func() {
 			closeErr := resp.Body.Close()
 			if closeErr != nil {
-				logger.Warnf("Error closing response body: %v", closeErr)
+				this.Logger.Warnf("Error closing response body: %v", closeErr)
 			}
 		}()
 	}
 	if err != nil {
 		return DownloadResult{}, err
 	}
+	finalUrl := *resp.Request.URL
+	redirects := redirectChain(resp.Request)
+	if resp.StatusCode == http.StatusNotModified {
+		return DownloadResult{
+			Url:          finalUrl,
+			Redirects:    redirects,
+			ContentType:  resp.Header.Get("Content-Type"),
+			ETag:         validators.ETag,
+			LastModified: validators.LastModified,
+			NotModified:  true,
+		}, nil
+	}
 	if resp.StatusCode >= 400 {
-		return DownloadResult{}, errors.New(fmt.Sprintf("Download received status %d", resp.StatusCode))
+		return DownloadResult{}, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	source := io.Reader(resp.Body)
+	if this.ReadTimeout > 0 {
+		idle := time.AfterFunc(this.ReadTimeout, func() {
+			cancel(&TimeoutError{Timeout: this.ReadTimeout, Idle: true})
+		})
+		idle.Stop()
+		defer idle.Stop()
+		source = &idleReader{reader: resp.Body, timer: idle, timeout: this.ReadTimeout}
+	}
+	buffered := bufio.NewReaderSize(source, sniff.HeadSize)
+	head, err := buffered.Peek(sniff.HeadSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return DownloadResult{}, err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if this.Sniffer != nil {
+		sniffed := this.Sniffer.ContentType(finalUrl, contentType, head)
+		if sniffed != contentType {
+			this.Logger.Debugf("Using content type %s instead of %q for %s", sniffed, contentType, finalUrl.String())
+		}
+		contentType = sniffed
+	}
+	if this.Excluded != nil && this.Excluded(finalUrl, contentType) {
+		return DownloadResult{}, &ExcludedError{ContentType: contentType}
+	}
+	limit := this.maxSize(contentType)
+	if limit > 0 && resp.ContentLength > limit {
+		return DownloadResult{}, &SizeError{ContentType: contentType, Limit: limit}
+	}
+	reader := io.Reader(buffered)
+	if limit > 0 {
+		reader = io.LimitReader(buffered, limit+1)
+	}
+	result := DownloadResult{
+		Url:          finalUrl,
+		Redirects:    redirects,
+		ContentType:  contentType,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	if stream != nil && stream(finalUrl, contentType) {
+		// Large files may take longer than the total timeout, they are limited by the idle timeout only
+		total.Stop()
+		tempFile, written, err := this.streamToFile(reader)
+		if err != nil {
+			return DownloadResult{}, err
+		}
+		if limit > 0 && written > limit {
+			_ = os.Remove(tempFile)
+			return DownloadResult{}, &SizeError{ContentType: contentType, Limit: limit}
+		}
+		result.TempFile = tempFile
+		return result, nil
+	}
+
+	body, err := io.ReadAll(reader)
 	if err != nil {
 		return DownloadResult{}, err
 	}
-	return DownloadResult{
-		Url:         url,
-		Content:     body,
-		ContentType: resp.Header.Get("Content-Type"),
-	}, nil
+	if limit > 0 && int64(len(body)) > limit {
+		return DownloadResult{}, &SizeError{ContentType: contentType, Limit: limit}
+	}
+	result.Content = body
+	return result, nil
+}
+
+func (this *Client) streamToFile(reader io.Reader) (string, int64, error) {
+	err := os.MkdirAll(this.TempDir, 0755)
+	if err != nil {
+		return "", 0, err
+	}
+	file, err := os.CreateTemp(this.TempDir, TempPattern)
+	if err != nil {
+		return "", 0, err
+	}
+	written, err := io.Copy(file, reader)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", 0, err
+	}
+	return file.Name(), written, nil
+}
+
+// maxSize returns size limit for the content type, 0 means unlimited.
+func (this *Client) maxSize(contentType string) int64 {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	mediaType = strings.ToLower(mediaType)
+	for _, limit := range this.MaxSizes {
+		if matched, _ := path.Match(limit.Pattern, mediaType); matched {
+			return limit.Size
+		}
+	}
+	return 0
+}
+
+// redirectChain returns urls of requests that were redirected before the request.
+func redirectChain(request *http.Request) []url.URL {
+	chain := make([]url.URL, 0)
+	for request.Response != nil && request.Response.Request != nil {
+		request = request.Response.Request
+		chain = append([]url.URL{*request.URL}, chain...)
+	}
+	return chain
+}
+
+// idleReader cancels the download when a single read waits longer than timeout.
+type idleReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (this *idleReader) Read(buffer []byte) (int, error) {
+	this.timer.Reset(this.timeout)
+	defer this.timer.Stop()
+	return this.reader.Read(buffer)
 }
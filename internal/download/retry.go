@@ -0,0 +1,128 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (this *StatusError) Error() string {
+	return fmt.Sprintf("Download received status %d", this.StatusCode)
+}
+
+// SizeError means the response is larger than the limit for its content type.
+type SizeError struct {
+	ContentType string
+	Limit       int64
+}
+
+func (this *SizeError) Error() string {
+	return fmt.Sprintf("Response of type %s exceeds maximum size of %d bytes", this.ContentType, this.Limit)
+}
+
+// ExcludedError means the content type of the response is excluded from the download.
+type ExcludedError struct {
+	ContentType string
+}
+
+func (this *ExcludedError) Error() string {
+	return fmt.Sprintf("Content type %s is excluded", this.ContentType)
+}
+
+// TimeoutError means the download took longer than the total timeout, or no data arrived for the idle timeout.
+type TimeoutError struct {
+	Timeout time.Duration
+	Idle    bool
+}
+
+func (this *TimeoutError) Error() string {
+	if this.Idle {
+		return fmt.Sprintf("No data received for %v", this.Timeout)
+	}
+	return fmt.Sprintf("Download did not finish in %v", this.Timeout)
+}
+
+type AttemptsError struct {
+	Attempts uint32
+	Err      error
+}
+
+func (this *AttemptsError) Error() string {
+	return fmt.Sprintf("%v (after %d attempts)", this.Err, this.Attempts)
+}
+
+func (this *AttemptsError) Unwrap() error {
+	return this.Err
+}
+
+type RetryPolicy struct {
+	MaxAttempts uint32
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var sizeErr *SizeError
+	if errors.As(err, &sizeErr) {
+		return false
+	}
+	var excludedErr *ExcludedError
+	if errors.As(err, &excludedErr) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusRequestTimeout ||
+			statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// delay returns how long to wait before the next attempt, attempt being the number of attempts already made.
+// Returns false when the server asks to wait longer than MaxDelay, the download should not be retried then.
+func (this RetryPolicy) delay(attempt uint32, err error) (time.Duration, bool) {
+	backoff := this.BaseDelay
+	for i := uint32(1); i < attempt && backoff < this.MaxDelay; i++ {
+		backoff *= 2
+	}
+	if backoff > this.MaxDelay {
+		backoff = this.MaxDelay
+	}
+	if backoff > 0 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > backoff {
+		return statusErr.RetryAfter, statusErr.RetryAfter <= this.MaxDelay
+	}
+	return backoff, true
+}
+
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if until := time.Until(date); until > 0 {
+			return until
+		}
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package download
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		attempt uint32
+		err     error
+		min     time.Duration
+		max     time.Duration
+		ok      bool
+	}{
+		{1, errors.New("network"), 500 * time.Millisecond, time.Second, true},
+		{2, errors.New("network"), time.Second, 2 * time.Second, true},
+		{3, errors.New("network"), 2 * time.Second, 4 * time.Second, true},
+		{4, errors.New("network"), 4 * time.Second, 8 * time.Second, true},
+		{5, errors.New("network"), 5 * time.Second, 10 * time.Second, true},
+		{30, errors.New("network"), 5 * time.Second, 10 * time.Second, true},
+		{1, &StatusError{StatusCode: 429, RetryAfter: 7 * time.Second}, 7 * time.Second, 7 * time.Second, true},
+		{1, &StatusError{StatusCode: 503, RetryAfter: 10 * time.Second}, 10 * time.Second, 10 * time.Second, true},
+		{1, &StatusError{StatusCode: 503, RetryAfter: 24 * time.Hour}, 24 * time.Hour, 24 * time.Hour, false},
+		{4, &StatusError{StatusCode: 503, RetryAfter: time.Millisecond}, 4 * time.Second, 8 * time.Second, true},
+	}
+	for _, test := range tests {
+		delay, ok := policy.delay(test.attempt, test.err)
+		if delay < test.min || delay > test.max || ok != test.ok {
+			t.Errorf("delay(%d, %v) = %v, %v, want between %v and %v, %v", test.attempt, test.err, delay, ok, test.min, test.max, test.ok)
+		}
+	}
+
+	if delay, ok := (RetryPolicy{}).delay(1, errors.New("network")); delay != 0 || !ok {
+		t.Errorf("delay without base delay = %v, %v, want 0, true", delay, ok)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 55 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, test := range tests {
+		if got := parseRetryAfter(test.header); got < test.min || got > test.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", test.header, got, test.min, test.max)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection reset"), true},
+		{&StatusError{StatusCode: http.StatusRequestTimeout}, true},
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&StatusError{StatusCode: http.StatusBadGateway}, true},
+		{&StatusError{StatusCode: http.StatusNotFound}, false},
+		{&SizeError{ContentType: "video/mp4", Limit: 10}, false},
+		{&ExcludedError{ContentType: "application/pdf"}, false},
+		{&TimeoutError{Timeout: time.Second, Idle: true}, true},
+	}
+	for _, test := range tests {
+		if got := isRetryable(test.err); got != test.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package fixup
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"go.uber.org/zap"
+)
+
+// Target is the replacement for links to a file that was never written.
+type Target struct {
+	// File relative to the output dir, used when not empty.
+	File string
+	// Url is the original absolute url, used when File is empty.
+	Url string
+}
+
+// localLink matches links written by the parsers, i.e. quoted values, css url() arguments and srcset candidates.
+// Quotes of css inside style attributes are escaped as html entities.
+var localLink = regexp.MustCompile(`(["'(]|&#34;|&quot;|&#39;|,\s*)([A-Za-z0-9._~%/+@:-]+)`)
+
+// Fixer rewrites links to missing files inside already saved documents.
+type Fixer struct {
+	Logger    *zap.SugaredLogger
+	OutputDir string
+	// Missing maps files relative to the output dir to their replacement.
+	Missing map[string]Target
+}
+
+// Fix rewrites links in the file relative to the output dir, returns number of rewritten links.
+func (this *Fixer) Fix(fileName string) (int, error) {
+	fullPath := filepath.Join(this.OutputDir, fileName)
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	result := localLink.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := localLink.FindSubmatch(match)
+		prefix, link := groups[1], string(groups[2])
+		target, ok := this.Missing[resolve(fileName, link)]
+		if !ok {
+			return match
+		}
+		rewritten++
+		if target.File == "" {
+			return append(append([]byte{}, prefix...), target.Url...)
+		}
+		return append(append([]byte{}, prefix...), relativeLink(fileName, target.File)...)
+	})
+	if rewritten == 0 {
+		return 0, nil
+	}
+	this.Logger.Debugf("Rewrote %d links to missing files in %s", rewritten, fileName)
+	return rewritten, os.WriteFile(fullPath, result, 0644)
+}
+
+// resolve returns file relative to the output dir that the link inside fromFile points to.
+func resolve(fromFile string, link string) string {
+	unescaped, err := url.PathUnescape(link)
+	if err != nil {
+		return ""
+	}
+	return filepath.Clean(filepath.Join(filepath.Dir(fromFile), filepath.FromSlash(unescaped)))
+}
+
+func relativeLink(fromFile string, toFile string) string {
+	relative, err := filepath.Rel(filepath.Dir(fromFile), toFile)
+	if err != nil {
+		relative = toFile
+	}
+	return (&url.URL{Path: filepath.ToSlash(relative)}).String()
+}
+
+// WritePlaceholder creates simple page for links to missing files, unless the file already exists.
+func WritePlaceholder(outputDir string, fileName string) error {
+	fullPath := filepath.Join(outputDir, fileName)
+	if _, err := os.Stat(fullPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fullPath, []byte(placeholder), 0644)
+}
+
+// WriteRedirect creates page redirecting to the link, used for urls redirected to another file.
+func WriteRedirect(outputDir string, fileName string, link string) error {
+	fullPath := filepath.Join(outputDir, fileName)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	escaped := html.EscapeString(link)
+	return os.WriteFile(fullPath, []byte(fmt.Sprintf(redirect, escaped, escaped, escaped)), 0644)
+}
+
+const redirect = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Redirect</title>
+<meta http-equiv="refresh" content="0; url=%s"><link rel="canonical" href="%s"></head>
+<body><p>This page was moved to <a href="%s">another location</a>.</p></body></html>
+`
+
+const placeholder = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Page not downloaded</title></head>
+<body><p>This page was not downloaded by scrappy.</p></body></html>
+`
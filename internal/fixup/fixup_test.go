@@ -0,0 +1,97 @@
+package fixup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFixerFix(t *testing.T) {
+	missing := map[string]Target{
+		"missing.html":          {Url: "http://site/missing.html"},
+		"img/gone.png":          {File: "placeholder.html"},
+		"docs/moved.html":       {File: "docs/canonical.html"},
+		"styles/missing.css":    {Url: "http://site/missing.css"},
+		"img/missing large.png": {Url: "http://site/missing%20large.png"},
+	}
+	tests := []struct {
+		fileName  string
+		content   string
+		want      string
+		rewritten int
+	}{
+		{
+			"index.html",
+			`<a href="missing.html">m</a><a href="present.html">p</a>`,
+			`<a href="http://site/missing.html">m</a><a href="present.html">p</a>`,
+			1,
+		},
+		{
+			"index.html",
+			`<img src='img/gone.png'><img src="img/logo.png">`,
+			`<img src='placeholder.html'><img src="img/logo.png">`,
+			1,
+		},
+		{
+			"docs/page.html",
+			`<a href="moved.html#top">m</a><a href="../missing.html">m</a><a href="missing.html">local</a>`,
+			`<a href="canonical.html#top">m</a><a href="http://site/missing.html">m</a><a href="missing.html">local</a>`,
+			2,
+		},
+		{
+			"index.html",
+			`<img srcset="img/logo.png 1x, img/gone.png 2x">`,
+			`<img srcset="img/logo.png 1x, placeholder.html 2x">`,
+			1,
+		},
+		{
+			"index.html",
+			`<div style="background: url(&#34;img/gone.png&#34;)"></div><div style="background: url(&quot;img/logo.png&quot;)"></div>`,
+			`<div style="background: url(&#34;placeholder.html&#34;)"></div><div style="background: url(&quot;img/logo.png&quot;)"></div>`,
+			1,
+		},
+		{
+			"styles/site.css",
+			`@import "missing.css"; body { background: url(../img/gone.png) } p { background: url(../img/logo.png) }`,
+			`@import "http://site/missing.css"; body { background: url(../placeholder.html) } p { background: url(../img/logo.png) }`,
+			2,
+		},
+		{
+			"index.html",
+			`<img src="img/missing%20large.png">`,
+			`<img src="http://site/missing%20large.png">`,
+			1,
+		},
+		{
+			"index.html",
+			`<p>missing.html is mentioned in text</p>`,
+			`<p>missing.html is mentioned in text</p>`,
+			0,
+		},
+	}
+	for _, test := range tests {
+		outputDir := t.TempDir()
+		fullPath := filepath.Join(outputDir, test.fileName)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		fixer := Fixer{Logger: zap.NewNop().Sugar(), OutputDir: outputDir, Missing: missing}
+		rewritten, err := fixer.Fix(test.fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != test.want || rewritten != test.rewritten {
+			t.Errorf("Fix(%q) of %s\n got %d: %s\nwant %d: %s", test.fileName, test.content, rewritten, content, test.rewritten, test.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package httpcache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	FileName = ".scrappy-cache.json"
+	RawDir   = ".scrappy-cache"
+)
+
+type Entry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	ContentType  string `json:"contentType"`
+	FileName     string `json:"fileName"`
+	// Raw is the original content relative to the output dir, stored only when the parser rewrote the content.
+	Raw string `json:"raw,omitempty"`
+}
+
+// Store keeps validators of downloaded urls, so that next crawl can send conditional requests.
+type Store struct {
+	OutputDir string
+	mutex     sync.Mutex
+	entries   map[string]Entry
+}
+
+func Load(outputDir string) (*Store, error) {
+	store := &Store{
+		OutputDir: outputDir,
+		mutex:     sync.Mutex{},
+		entries:   make(map[string]Entry),
+	}
+	content, err := os.ReadFile(filepath.Join(outputDir, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &store.entries)
+	return store, err
+}
+
+func (this *Store) Get(url string) (Entry, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	entry, ok := this.entries[url]
+	return entry, ok
+}
+
+// Put stores validators of a download, entries without validators are removed.
+func (this *Store) Put(url string, entry Entry) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if entry.ETag == "" && entry.LastModified == "" {
+		delete(this.entries, url)
+		return
+	}
+	this.entries[url] = entry
+}
+
+// SaveRaw stores the original content of url, used when the saved file differs from what server returned.
+func (this *Store) SaveRaw(url string, content []byte) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	entry, ok := this.entries[url]
+	if !ok {
+		return nil
+	}
+	hash := sha1.Sum([]byte(url))
+	raw := filepath.Join(RawDir, hex.EncodeToString(hash[:]))
+	err := os.MkdirAll(filepath.Join(this.OutputDir, RawDir), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(this.OutputDir, raw), content, 0644)
+	if err != nil {
+		return err
+	}
+	entry.Raw = raw
+	this.entries[url] = entry
+	return nil
+}
+
+// Content returns the original content of not modified url from the previous crawl.
+func (this *Store) Content(url string) ([]byte, Entry, error) {
+	entry, ok := this.Get(url)
+	if !ok {
+		return nil, Entry{}, errors.New("Url is not cached")
+	}
+	path := entry.FileName
+	if entry.Raw != "" {
+		path = entry.Raw
+	}
+	content, err := os.ReadFile(filepath.Join(this.OutputDir, path))
+	return content, entry, err
+}
+
+func (this *Store) Save() error {
+	this.mutex.Lock()
+	content, err := json.Marshal(this.entries)
+	this.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(this.OutputDir, 0755)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(this.OutputDir, FileName)
+	err = os.WriteFile(path+".tmp", content, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
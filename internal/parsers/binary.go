@@ -0,0 +1,61 @@
+package parsers
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+)
+
+// BinaryPolicy decides which content without parser is stored as it is.
+type BinaryPolicy struct {
+	// Allowed are path.Match patterns of content types stored without changes, e.g. "application/pdf".
+	Allowed []string
+	// Excluded are patterns of content types that are never downloaded, links to them keep the original url.
+	Excluded []string
+}
+
+func NewBinaryPolicy(args *config.Config) *BinaryPolicy {
+	return &BinaryPolicy{
+		Allowed:  args.BinaryTypes,
+		Excluded: args.ExcludeBinaryTypes,
+	}
+}
+
+// MediaType returns lowercase content type without parameters.
+func MediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	return strings.ToLower(mediaType)
+}
+
+func (this *BinaryPolicy) Allows(contentType string) bool {
+	return !this.Excludes(contentType) && matchesMediaType(this.Allowed, MediaType(contentType))
+}
+
+func (this *BinaryPolicy) Excludes(contentType string) bool {
+	return matchesMediaType(this.Excluded, MediaType(contentType))
+}
+
+// ExcludesUrl guesses the content type from the url extension, before the file is downloaded.
+func (this *BinaryPolicy) ExcludesUrl(link url.URL) bool {
+	extension := path.Ext(link.Path)
+	if extension == "" {
+		return false
+	}
+	contentType := mime.TypeByExtension(strings.ToLower(extension))
+	return contentType != "" && this.Excludes(contentType)
+}
+
+func matchesMediaType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), mediaType); matched {
+			return true
+		}
+	}
+	return false
+}
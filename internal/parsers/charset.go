@@ -0,0 +1,71 @@
+package parsers
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+var (
+	utf8Bom    = []byte{0xEF, 0xBB, 0xBF}
+	cssCharset = regexp.MustCompile(`^@charset\s+["']([^"']+)["']\s*;`)
+)
+
+// DecodeText transcodes html and css content into UTF-8, other content is returned unchanged.
+// Returns name of the detected charset.
+func DecodeText(content []byte, contentType string) ([]byte, string, error) {
+	var decoder encoding.Encoding
+	var name string
+	switch MediaType(contentType) {
+	case "text/html", "application/xhtml+xml":
+		var certain bool
+		decoder, name, certain = charset.DetermineEncoding(content, contentType)
+		// Only the beginning of the document is inspected, windows-1252 is the fallback for undeclared pages
+		// whose beginning is ASCII, they are UTF-8 when the whole body is valid
+		if !certain && name == "windows-1252" && utf8.Valid(content) {
+			decoder, name = charset.Lookup("utf-8")
+		}
+	case "text/css":
+		decoder, name = cssEncoding(content, contentType)
+	default:
+		return content, "", nil
+	}
+
+	if name != "utf-8" {
+		decoded, err := decoder.NewDecoder().Bytes(content)
+		if err != nil {
+			return content, name, err
+		}
+		content = decoded
+	}
+	content = bytes.TrimPrefix(content, utf8Bom)
+	if MediaType(contentType) == "text/css" {
+		content = cssCharset.ReplaceAll(content, []byte(`@charset "UTF-8";`))
+	}
+	return content, name, nil
+}
+
+// cssEncoding detects charset of the stylesheet from BOM, the header or the @charset rule.
+func cssEncoding(content []byte, contentType string) (encoding.Encoding, string) {
+	if bytes.HasPrefix(content, utf8Bom) {
+		return charset.Lookup("utf-8")
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if decoder, name := charset.Lookup(params["charset"]); decoder != nil {
+			return decoder, name
+		}
+	}
+	if match := cssCharset.FindSubmatch(content); match != nil {
+		if decoder, name := charset.Lookup(string(match[1])); decoder != nil {
+			return decoder, name
+		}
+	}
+	if !utf8.Valid(content) {
+		return charset.Lookup("windows-1252")
+	}
+	return charset.Lookup("utf-8")
+}
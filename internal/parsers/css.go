@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"strings"
 
 	"github.com/tdewolff/parse/css"
 	"go.uber.org/zap"
@@ -18,10 +19,55 @@ type CssParser struct {
 
 func (this *CssParser) Process(content []byte, arg DownloadArg) ([]byte, []DownloadArg, error) {
 	this.location = arg.Url
+	result, links, err := rewriteCssUrls(content, this.location, arg.Depth, arg.FileName, this.Logger, this.PathProcessor)
+	if err != nil {
+		this.Logger.Errorf("Error parsing css: %s: %v", arg.Url.String(), err)
+		return content, []DownloadArg{}, nil
+	}
+	return result, links, nil
+}
+
+// rewriteCssUrls replaces url() references, @import strings and strings in image-set() and @font-face src
+// with local paths relative to fromFile, the file that contains the css.
+func rewriteCssUrls(
+	content []byte,
+	location url.URL,
+	depth uint64,
+	fromFile string,
+	logger *zap.SugaredLogger,
+	pathProcessor *PathProcessor,
+) ([]byte, []DownloadArg, error) {
 	parser := css.NewLexer(bytes.NewReader(content))
 	out := bytes.NewBuffer([]byte{})
 	links := []DownloadArg{}
 
+	rewrite := func(link string) (string, bool) {
+		if link == "" || strings.HasPrefix(link, "data:") || strings.HasPrefix(link, "#") {
+			return "", false
+		}
+		logger.Debugf("Found link in styles: %s", link)
+		p := pathProcessor.HandlePath(link, location, "in-css")
+		if !p.Success {
+			logger.Warnf("Could not parse css link: %s", link)
+			return "", false
+		}
+		logger.Debugf("Parsed css link %s saved into %s", p.Url.String(), p.LocalPath)
+		links = append(links, DownloadArg{
+			Url:      p.Url,
+			Depth:    depth,
+			FileName: p.LocalPath,
+		})
+		return p.RelativeTo(fromFile), true
+	}
+
+	importPending := false
+	fontFacePending := false
+	fontFaceDepth := -1
+	braceDepth := 0
+	lastIdent := ""
+	property := ""
+	functions := []string{}
+
 	for {
 		tt, b := parser.Next()
 		switch tt {
@@ -31,27 +77,80 @@ func (this *CssParser) Process(content []byte, arg DownloadArg) ([]byte, []Downl
 				result := out.Bytes()
 				return result, links, nil
 			}
-			this.Logger.Errorf("Error parsing css: %s: %v", arg.Url.String(), parser.Err())
-			return content, []DownloadArg{}, nil
+			return nil, nil, err
+		case css.WhitespaceToken, css.CommentToken:
+			out.Write(b)
+			continue
 		case css.URLToken:
 			s := string(b)
-			link := s[4 : len(s)-1]
-			this.Logger.Debugf("Found link in styles: %s", link)
-			p := this.PathProcessor.HandlePath(link, this.location, "in-css")
-			if !p.Success {
-				this.Logger.Warnf("Could not parse css link: %s", link)
+			link := strings.Trim(strings.TrimSpace(s[4:len(s)-1]), "\"'")
+			if local, ok := rewrite(link); ok {
+				out.WriteString(fmt.Sprintf("url(\"%s\")", local))
+			} else {
+				out.Write(b)
+			}
+		case css.StringToken:
+			function := ""
+			if len(functions) > 0 {
+				function = functions[len(functions)-1]
+			}
+			isLink := importPending ||
+				function == "image-set" || function == "-webkit-image-set" ||
+				(fontFaceDepth >= 0 && property == "src" && len(functions) == 0)
+			if !isLink {
+				out.Write(b)
+				break
+			}
+			s := string(b)
+			if local, ok := rewrite(s[1 : len(s)-1]); ok {
+				out.WriteString(fmt.Sprintf("\"%s\"", local))
+			} else {
 				out.Write(b)
-				continue
-			}
-			this.Logger.Debugf("Parsed css link %s saved into %s", p.Url.String(), p.LocalPath)
-			out.WriteString(fmt.Sprintf("url(\"../%s\")", p.RelativeUrl))
-			links = append(links, DownloadArg{
-				Url:      p.Url,
-				Depth:    arg.Depth + 1,
-				FileName: p.LocalPath,
-			})
+			}
+		case css.AtKeywordToken:
+			keyword := strings.ToLower(string(b))
+			importPending = keyword == "@import"
+			fontFacePending = keyword == "@font-face"
+			out.Write(b)
+			continue
+		case css.FunctionToken:
+			functions = append(functions, strings.ToLower(strings.TrimSuffix(string(b), "(")))
+			out.Write(b)
+		case css.LeftParenthesisToken:
+			functions = append(functions, "")
+			out.Write(b)
+		case css.RightParenthesisToken:
+			if len(functions) > 0 {
+				functions = functions[:len(functions)-1]
+			}
+			out.Write(b)
+		case css.LeftBraceToken:
+			if fontFacePending {
+				fontFaceDepth = braceDepth
+			}
+			braceDepth++
+			property = ""
+			out.Write(b)
+		case css.RightBraceToken:
+			braceDepth--
+			if braceDepth == fontFaceDepth {
+				fontFaceDepth = -1
+			}
+			property = ""
+			out.Write(b)
+		case css.IdentToken:
+			lastIdent = strings.ToLower(string(b))
+			out.Write(b)
+		case css.ColonToken:
+			property = lastIdent
+			out.Write(b)
+		case css.SemicolonToken:
+			property = ""
+			out.Write(b)
 		default:
 			out.Write(b)
 		}
+		importPending = false
+		fontFacePending = false
 	}
 }
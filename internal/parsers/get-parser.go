@@ -2,41 +2,14 @@ package parsers
 
 import (
 	"net/url"
-	"strings"
 
 	"go.uber.org/zap"
-
-	"github.com/PatrikValkovic/scrappy/internal/config"
 )
 
 type Parser interface {
 	Process(content []byte, download DownloadArg) ([]byte, []DownloadArg, error)
 }
 
-func GetParser(
-	contentType string,
-	logger *zap.SugaredLogger,
-	args *config.Config,
-	pathProcessor *PathProcessor,
-) Parser {
-	switch true {
-	case strings.Contains(contentType, "text/html"):
-		return &HtmlParser{Logger: logger, Args: args, PathProcessor: pathProcessor}
-	case strings.Contains(contentType, "text/css"):
-		return &CssParser{Logger: logger, PathProcessor: pathProcessor}
-	case strings.Contains(contentType, "javascript"):
-		return &JavaScriptParser{}
-	case strings.HasPrefix(contentType, "image/"):
-		return &PassthroughParser{}
-	case strings.HasPrefix(contentType, "font/"):
-		return &PassthroughParser{}
-	case strings.HasPrefix(contentType, "video/"):
-		return &PassthroughParser{}
-	default:
-		return nil
-	}
-}
-
 type DownloadArg struct {
 	Url        url.URL
 	IsRequired bool
@@ -45,9 +18,14 @@ type DownloadArg struct {
 }
 
 type ParseArg struct {
+	// DownloadArg has the final url after redirects and the file the content is stored into.
 	DownloadArg DownloadArg
-	Body        []byte
-	ContentType string
+	// RequestUrl is the url that was requested, it differs from DownloadArg.Url when redirected.
+	RequestUrl   url.URL
+	Body         []byte
+	ContentType  string
+	ETag         string
+	LastModified string
 }
 
 func NewDownloadArg(
@@ -58,10 +36,8 @@ func NewDownloadArg(
 	depth uint64,
 ) (DownloadArg, error) {
 	parsedUrl, err := url.Parse(link)
-	if err != nil && required {
-		logger.Fatalf("Url \"%s\" is not a valid URL", link)
-	}
 	if err != nil {
+		logger.Debugf("Url \"%s\" is not a valid URL", link)
 		return DownloadArg{}, err
 	}
 	return DownloadArg{
@@ -79,6 +55,7 @@ func NewParseArg(
 ) ParseArg {
 	return ParseArg{
 		DownloadArg: downloadArg,
+		RequestUrl:  downloadArg.Url,
 		Body:        body,
 		ContentType: contentType,
 	}
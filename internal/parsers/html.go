@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net/url"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 	"go.uber.org/zap"
@@ -20,11 +21,13 @@ type HtmlParser struct {
 
 	location url.URL
 	depth    uint64
+	fileName string
 }
 
 func (this *HtmlParser) Process(content []byte, download DownloadArg) ([]byte, []DownloadArg, error) {
 	this.location = download.Url
 	this.depth = download.Depth
+	this.fileName = download.FileName
 
 	document, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
 	if err != nil {
@@ -33,9 +36,14 @@ func (this *HtmlParser) Process(content []byte, download DownloadArg) ([]byte, [
 	document.Find("noscript").Each(func(i int, s *goquery.Selection) {
 		s.ReplaceWithHtml(s.Text())
 	})
+	this.processCharset(document, content)
+	this.processBase(document)
+	this.processCanonical(document, download)
 
 	cssDownloads := this.processCss(document)
+	inlineStyleDownloads := this.processInlineStyles(document)
 	imageDownloads := this.processImages(document)
+	srcsetDownloads := this.processSrcset(document)
 	scriptsDownloads := this.processScripts(document)
 	videoDownloads := this.processVideo(document)
 	linksDownloads := this.processLinks(document)
@@ -54,13 +62,84 @@ func (this *HtmlParser) Process(content []byte, download DownloadArg) ([]byte, [
 	result := buffer.Bytes()
 	return result, concat([][]DownloadArg{
 		cssDownloads,
+		inlineStyleDownloads,
 		imageDownloads,
+		srcsetDownloads,
 		scriptsDownloads,
 		videoDownloads,
 		linksDownloads,
 	}), nil
 }
 
+// processBase uses <base href> as the location for resolving links and removes it,
+// because rewritten links are relative to the saved file.
+func (this *HtmlParser) processBase(document *goquery.Document) {
+	baseElements := document.Find("base[href]")
+	if baseElements.Length() == 0 {
+		return
+	}
+	hrefAttr := baseElements.First().AttrOr("href", "")
+	base, err := url.Parse(strings.TrimSpace(hrefAttr))
+	if err != nil {
+		this.Logger.Warnf("Could not parse base href: %s", hrefAttr)
+	} else {
+		this.location = *this.location.ResolveReference(base)
+		this.Logger.Debugf("Using base %s for links", this.location.String())
+	}
+	baseElements.Each(func(i int, s *goquery.Selection) {
+		if _, hasTarget := s.Attr("target"); hasTarget {
+			s.RemoveAttr("href")
+		} else {
+			s.Remove()
+		}
+	})
+}
+
+// processCharset declares UTF-8, content is transcoded before parsing and the saved file has no Content-Type header.
+// Declarations are kept when the content is not valid UTF-8, i.e. it could not be transcoded.
+func (this *HtmlParser) processCharset(document *goquery.Document, content []byte) {
+	if !utf8.Valid(content) {
+		this.Logger.Debugf("Content of %s is not valid UTF-8, keeping its charset declaration", this.location.String())
+		return
+	}
+	declarations := document.Find("meta[charset]")
+	declarations.SetAttr("charset", "utf-8")
+	document.Find("meta[http-equiv]").Each(func(i int, s *goquery.Selection) {
+		if strings.EqualFold(s.AttrOr("http-equiv", ""), "content-type") {
+			s.SetAttr("content", "text/html; charset=utf-8")
+			declarations = declarations.AddSelection(s)
+		}
+	})
+	if declarations.Length() == 0 {
+		document.Find("head").First().PrependHtml(`<meta charset="utf-8">`)
+	}
+}
+
+// processCanonical marks the page as an alias of its <link rel="canonical">, when it points to a different url.
+// The page is then stored under the canonical file and links inside it are relative to that file.
+func (this *HtmlParser) processCanonical(document *goquery.Document, download DownloadArg) {
+	hrefAttr := strings.TrimSpace(document.Find("link[rel=\"canonical\"][href]").First().AttrOr("href", ""))
+	if hrefAttr == "" {
+		return
+	}
+	processed := this.PathProcessor.HandlePath(hrefAttr, this.location, ".")
+	if !processed.Success {
+		this.Logger.Warnf("Could not parse canonical link: %s", hrefAttr)
+		return
+	}
+	canonicalizer := this.PathProcessor.Canonicalizer
+	if canonicalizer.Key(processed.Url) == canonicalizer.Key(download.Url) {
+		return
+	}
+	if !strings.HasPrefix(processed.Canonical.String(), this.Args.RequiredPrefix) {
+		this.Logger.Debugf("Canonical url %s does not have required prefix %s", processed.Url.String(), this.Args.RequiredPrefix)
+		return
+	}
+	this.Logger.Debugf("Page %s is alias of %s stored into %s", download.Url.String(), processed.Url.String(), processed.LocalPath)
+	this.PathProcessor.Alias(download.Url, processed)
+	this.fileName = processed.LocalPath
+}
+
 func concat(slices [][]DownloadArg) []DownloadArg {
 	var totalLen int
 	for _, s := range slices {
@@ -97,7 +176,7 @@ func (this *HtmlParser) processCss(document *goquery.Document) []DownloadArg {
 				this.Logger,
 				this.depth,
 			)
-			s.SetAttr("href", processed.RelativeUrl)
+			s.SetAttr("href", processed.RelativeTo(this.fileName))
 			if err != nil {
 				this.Logger.Warnf("Could not parse css file link: %s", err)
 				return
@@ -108,6 +187,40 @@ func (this *HtmlParser) processCss(document *goquery.Document) []DownloadArg {
 	return cssDownloads
 }
 
+func (this *HtmlParser) processInlineStyles(document *goquery.Document) []DownloadArg {
+	styleDownloads := make([]DownloadArg, 0)
+
+	styleElements := document.Find("style")
+	this.Logger.Debugf("Found %d style elements", styleElements.Length())
+	styleElements.Each(func(i int, s *goquery.Selection) {
+		result, links, err := rewriteCssUrls([]byte(s.Text()), this.location, this.depth, this.fileName, this.Logger, this.PathProcessor)
+		if err != nil {
+			this.Logger.Warnf("Could not parse style element: %v", err)
+			return
+		}
+		s.SetHtml(string(result))
+		styleDownloads = append(styleDownloads, links...)
+	})
+
+	styleAttributes := document.Find("[style]")
+	this.Logger.Debugf("Found %d style attributes", styleAttributes.Length())
+	styleAttributes.Each(func(i int, s *goquery.Selection) {
+		style := s.AttrOr("style", "")
+		if !strings.Contains(strings.ToLower(style), "url(") {
+			return
+		}
+		result, links, err := rewriteCssUrls([]byte(style), this.location, this.depth, this.fileName, this.Logger, this.PathProcessor)
+		if err != nil {
+			this.Logger.Warnf("Could not parse style attribute: %v", err)
+			return
+		}
+		s.SetAttr("style", string(result))
+		styleDownloads = append(styleDownloads, links...)
+	})
+
+	return styleDownloads
+}
+
 func (this *HtmlParser) processImages(document *goquery.Document) []DownloadArg {
 	imgElements := document.Find("img[src]")
 	imgDownloads := make([]DownloadArg, 0)
@@ -135,7 +248,7 @@ func (this *HtmlParser) processImages(document *goquery.Document) []DownloadArg
 				this.Logger,
 				this.depth,
 			)
-			s.SetAttr("src", processed.RelativeUrl)
+			s.SetAttr("src", processed.RelativeTo(this.fileName))
 			if err != nil {
 				this.Logger.Warnf("Could not create image download link: %s", err)
 				return
@@ -146,6 +259,63 @@ func (this *HtmlParser) processImages(document *goquery.Document) []DownloadArg
 	return imgDownloads
 }
 
+func (this *HtmlParser) processSrcset(document *goquery.Document) []DownloadArg {
+	srcsetElements := document.Find("img[srcset], source[srcset]")
+	srcsetDownloads := make([]DownloadArg, 0)
+	this.Logger.Debugf("Found %d srcset attributes", srcsetElements.Length())
+	srcsetElements.Each(func(i int, s *goquery.Selection) {
+		candidates := parseSrcset(s.AttrOr("srcset", ""))
+		if len(candidates) == 0 {
+			return
+		}
+		selected := candidates
+		largest := largestSrcsetCandidate(candidates)
+		if this.Args.SrcsetMode == config.SrcsetLargest {
+			selected = []srcsetCandidate{largest}
+		}
+
+		localUrls := make(map[string]string)
+		for _, candidate := range selected {
+			if strings.HasPrefix(candidate.Url, "data:") {
+				continue
+			}
+			this.Logger.Debugf("Found srcset image: %s", candidate.Url)
+			processed := this.PathProcessor.HandlePath(candidate.Url, this.location, "img")
+			if !processed.Success {
+				this.Logger.Warnf("Could not parse srcset image link: %s", candidate.Url)
+				continue
+			}
+			this.Logger.Debugf("Srcset image %s will be stored into %s", processed.Url.String(), processed.LocalPath)
+			downloadArg, err := NewDownloadArg(
+				processed.Url.String(),
+				false,
+				processed.LocalPath,
+				this.Logger,
+				this.depth,
+			)
+			if err != nil {
+				this.Logger.Warnf("Could not create srcset image download link: %s", err)
+				continue
+			}
+			localUrls[candidate.Url] = processed.RelativeTo(this.fileName)
+			srcsetDownloads = append(srcsetDownloads, downloadArg)
+		}
+
+		rewritten := make([]string, 0, len(candidates))
+		for _, candidate := range candidates {
+			link := candidate.Url
+			if local, ok := localUrls[candidate.Url]; ok {
+				link = local
+			} else if local, ok := localUrls[largest.Url]; ok && !strings.HasPrefix(link, "data:") {
+				link = local
+			}
+			rewritten = append(rewritten, strings.TrimSpace(link+" "+candidate.Descriptor))
+		}
+		s.SetAttr("srcset", strings.Join(rewritten, ", "))
+	})
+	return srcsetDownloads
+}
+
 func (this *HtmlParser) processScripts(document *goquery.Document) []DownloadArg {
 	scriptsElements := document.Find("script[src]")
 	scriptDownloads := make([]DownloadArg, 0)
@@ -173,7 +343,7 @@ func (this *HtmlParser) processScripts(document *goquery.Document) []DownloadArg
 				this.Logger,
 				this.depth,
 			)
-			s.SetAttr("src", processed.RelativeUrl)
+			s.SetAttr("src", processed.RelativeTo(this.fileName))
 			if err != nil {
 				this.Logger.Warnf("Could not create script download link: %s", err)
 				return
@@ -203,7 +373,7 @@ func (this *HtmlParser) processLinks(document *goquery.Document) []DownloadArg {
 				this.Logger.Warnf("Could not parse link href: %s", hrefAttr)
 				return
 			}
-			if !strings.HasPrefix(processed.Url.String(), this.Args.RequiredPrefix) {
+			if !strings.HasPrefix(processed.Canonical.String(), this.Args.RequiredPrefix) {
 				this.Logger.Debugf("Link %s does not have required prefix %s", processed.Url.String(), this.Args.RequiredPrefix)
 				return
 			}
@@ -213,6 +383,11 @@ func (this *HtmlParser) processLinks(document *goquery.Document) []DownloadArg {
 					return
 				}
 			}
+			if NewBinaryPolicy(this.Args).ExcludesUrl(processed.Url) {
+				this.Logger.Debugf("Link %s has excluded content type, keeping original url", processed.Url.String())
+				s.SetAttr("href", processed.Url.String())
+				return
+			}
 			this.Logger.Debugf("Link %s will be stored into %s", processed.Url.String(), processed.LocalPath)
 			downloadArg, err := NewDownloadArg(
 				processed.Url.String(),
@@ -221,7 +396,7 @@ func (this *HtmlParser) processLinks(document *goquery.Document) []DownloadArg {
 				this.Logger,
 				this.depth+1,
 			)
-			s.SetAttr("href", processed.RelativeUrl)
+			s.SetAttr("href", processed.RelativeTo(this.fileName))
 			s.RemoveAttr("integrity").RemoveAttr("crossorigin")
 			if err != nil {
 				this.Logger.Warnf("Could not parse link href: %s", err)
@@ -261,7 +436,7 @@ func (this *HtmlParser) processVideo(document *goquery.Document) []DownloadArg {
 				this.Logger,
 				this.depth,
 			)
-			s.SetAttr("poster", processed.RelativeUrl)
+			s.SetAttr("poster", processed.RelativeTo(this.fileName))
 			if err != nil {
 				this.Logger.Warnf("Could not create video poster link: %s", err)
 				return
@@ -295,7 +470,7 @@ func (this *HtmlParser) processVideo(document *goquery.Document) []DownloadArg {
 				this.Logger,
 				this.depth,
 			)
-			s.SetAttr("src", processed.RelativeUrl)
+			s.SetAttr("src", processed.RelativeTo(this.fileName))
 			if err != nil {
 				this.Logger.Warnf("Could not create video source link: %s", err)
 				return
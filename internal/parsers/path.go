@@ -1,37 +1,72 @@
 package parsers
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"net/url"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"unicode"
 
 	"go.uber.org/zap"
+
+	"github.com/PatrikValkovic/scrappy/internal/canonical"
+	"github.com/PatrikValkovic/scrappy/internal/config"
 )
 
 type ProcessedPath struct {
-	Success     bool
-	Url         url.URL
-	LocalPath   string
+	Success bool
+	// Url is the resolved link as written on the page, it is the url that is downloaded.
+	Url url.URL
+	// Canonical is the canonicalized Url, used for de-duplication, file mapping and prefix checks.
+	Canonical url.URL
+	LocalPath string
+	// RelativeUrl is LocalPath with fragment, relative to the output root. Use RelativeTo for links inside files.
 	RelativeUrl string
 }
 
+// RelativeTo returns link to the local file usable from fromFile, both paths are relative to the output root.
+func (this ProcessedPath) RelativeTo(fromFile string) string {
+	relative, err := filepath.Rel(filepath.Dir(fromFile), this.LocalPath)
+	if err != nil {
+		relative = this.LocalPath
+	}
+	link := (&url.URL{Path: filepath.ToSlash(relative)}).String()
+	if this.Url.Fragment != "" {
+		link = link + "#" + this.Url.Fragment
+	}
+	return link
+}
+
 type PathProcessor struct {
-	Logger    *zap.SugaredLogger
-	Location  *url.URL
-	mutex     sync.Mutex
-	urlToFile map[string]string
-	fileToUrl map[string]string
+	Logger   *zap.SugaredLogger
+	Location *url.URL
+	// Layout is one of config.LayoutFlat, config.LayoutTree or config.LayoutTreeHost.
+	Layout string
+	// Canonicalizer normalizes resolved urls, files are mapped by canonical url.
+	Canonicalizer *canonical.Canonicalizer
+	mutex         sync.Mutex
+	urlToFile     map[string]string
+	fileToUrl     map[string]string
+	canonicals    map[string]ProcessedPath
+	// directories are parent directories of the assigned files, a file can not be stored under such name.
+	directories map[string]bool
 }
 
-func NewPathProcessor(logger *zap.SugaredLogger, location *url.URL) *PathProcessor {
+func NewPathProcessor(logger *zap.SugaredLogger, location *url.URL, args *config.Config) *PathProcessor {
 	return &PathProcessor{
-		Logger:    logger,
-		Location:  location,
-		mutex:     sync.Mutex{},
-		urlToFile: make(map[string]string),
-		fileToUrl: make(map[string]string),
+		Logger:        logger,
+		Location:      location,
+		Layout:        args.Layout,
+		Canonicalizer: canonical.New(args),
+		mutex:         sync.Mutex{},
+		urlToFile:     make(map[string]string),
+		fileToUrl:     make(map[string]string),
+		canonicals:    make(map[string]ProcessedPath),
+		directories:   make(map[string]bool),
 	}
 }
 
@@ -48,19 +83,54 @@ func (this *PathProcessor) HandlePath(
 		this.Logger.Warnf("Could not parse css file link: %s", err)
 		return ProcessedPath{Success: false}
 	}
+	// The canonical url only names the file, the server may need e.g. ignored session parameters
 	resolved := onSite.ResolveReference(fullUrl)
-	resolvedWithoutFragment := *resolved
-	resolvedWithoutFragment.Fragment = ""
+	canonicalUrl := this.Canonicalizer.Url(*resolved)
+	key := this.Canonicalizer.Key(canonicalUrl)
 
-	if existingPath := this.urlToFile[resolvedWithoutFragment.String()]; existingPath != "" {
+	if existingPath := this.urlToFile[key]; existingPath != "" {
 		return ProcessedPath{
 			Success:     true,
 			Url:         *resolved,
+			Canonical:   canonicalUrl,
 			LocalPath:   existingPath,
-			RelativeUrl: existingPath + resolved.Fragment,
+			RelativeUrl: relativeUrlOf(existingPath, resolved.Fragment),
 		}
 	}
 
+	var fileName string
+	if this.Layout == config.LayoutTree || this.Layout == config.LayoutTreeHost {
+		fileName = this.treeFileName(&canonicalUrl)
+		if _, taken := this.fileToUrl[fileName]; taken || this.directories[fileName] {
+			// e.g. /docs/intro and /docs/intro/ without folded trailing slash
+			hash := sha1.Sum([]byte(key))
+			extension := filepath.Ext(fileName)
+			suffixed := fileName[:len(fileName)-len(extension)] + "_" + hex.EncodeToString(hash[:])[:8] + extension
+			this.Logger.Debugf("Url %s collides with file %s, storing into %s", key, fileName, suffixed)
+			fileName = suffixed
+		}
+	} else {
+		fileName = this.flatFileName(&canonicalUrl, localPrefix)
+	}
+
+	if !filepath.IsLocal(fileName) {
+		this.Logger.Warnf("Url %s maps to file %s outside of the output directory", key, fileName)
+		return ProcessedPath{Success: false}
+	}
+
+	this.assign(key, fileName)
+
+	return ProcessedPath{
+		Success:     true,
+		Url:         *resolved,
+		Canonical:   canonicalUrl,
+		LocalPath:   fileName,
+		RelativeUrl: relativeUrlOf(fileName, resolved.Fragment),
+	}
+}
+
+// flatFileName stores the file into localPrefix directory, name clashes are resolved by a counter suffix.
+func (this *PathProcessor) flatFileName(resolved *url.URL, localPrefix string) string {
 	relativeFileName := resolved.Path
 	if strings.HasPrefix(relativeFileName, this.Location.Path) {
 		relativeFileName = relativeFileName[len(this.Location.Path):]
@@ -81,6 +151,7 @@ func (this *PathProcessor) HandlePath(
 		relativeFileName = relativeFileName + ".html"
 	}
 
+	relativeFileName = withQuerySuffix(relativeFileName, resolved.RawQuery)
 	fileName := filepath.Join(localPrefix, relativeFileName)
 	counter := 0
 	for _, ok := this.fileToUrl[fileName]; ok; _, ok = this.fileToUrl[fileName] {
@@ -91,19 +162,158 @@ func (this *PathProcessor) HandlePath(
 			fmt.Sprintf("%s_%d%s", relativeFileName[:len(relativeFileName)-len(extension)], counter, extension),
 		)
 	}
+	return fileName
+}
 
-	this.fileToUrl[fileName] = resolvedWithoutFragment.String()
-	this.urlToFile[resolvedWithoutFragment.String()] = fileName
+// treeFileName mirrors the url path on disk, the name depends only on the url.
+// Pages without extension (or with one without letters, like v1.2) are stored as index.html in a directory of the same name.
+// Dot segments are resolved against the root, so that the file can not escape the output directory.
+func (this *PathProcessor) treeFileName(resolved *url.URL) string {
+	segments := strings.Split(strings.TrimPrefix(path.Clean("/"+resolved.Path), "/"), "/")
+	last := segments[len(segments)-1]
+	if last == "" {
+		segments[len(segments)-1] = "index.html"
+	} else if !hasFileExtension(last) || strings.HasSuffix(resolved.Path, "/") {
+		segments = append(segments, "index.html")
+	}
+	segments[len(segments)-1] = withQuerySuffix(segments[len(segments)-1], resolved.RawQuery)
 
-	relativeUrl := fileName
-	if resolved.Fragment != "" {
-		relativeUrl = fileName + "#" + resolved.Fragment
+	host := strings.ReplaceAll(strings.ToLower(resolved.Host), ":", "_")
+	if this.Layout == config.LayoutTreeHost || (host != "" && host != strings.ReplaceAll(strings.ToLower(this.Location.Host), ":", "_")) {
+		segments = append([]string{host}, segments...)
 	}
+	return filepath.Join(segments...)
+}
 
-	return ProcessedPath{
-		Success:     true,
-		Url:         *resolved,
-		LocalPath:   fileName,
-		RelativeUrl: relativeUrl,
+// hasFileExtension reports whether the extension of the segment contains a letter, so that e.g. v1.2 is a directory.
+func hasFileExtension(segment string) bool {
+	return strings.IndexFunc(path.Ext(segment), unicode.IsLetter) >= 0
+}
+
+// withQuerySuffix inserts filesystem safe form of the query before the file extension.
+// Short queries stay readable (page=1 becomes _page-1), longer ones are replaced by their hash.
+// Queries containing - or _ are hashed as well, their readable form would be ambiguous.
+func withQuerySuffix(fileName string, rawQuery string) string {
+	if rawQuery == "" {
+		return fileName
+	}
+	suffix := strings.NewReplacer("=", "-", "&", "_").Replace(rawQuery)
+	safe := len(suffix) <= 40 && !strings.ContainsAny(rawQuery, "-_")
+	for _, r := range suffix {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			safe = false
+			break
+		}
+	}
+	if !safe {
+		hash := sha1.Sum([]byte(rawQuery))
+		suffix = "q" + hex.EncodeToString(hash[:])[:10]
+	}
+	extension := filepath.Ext(fileName)
+	return fileName[:len(fileName)-len(extension)] + "_" + suffix + extension
+}
+
+func relativeUrlOf(fileName string, fragment string) string {
+	if fragment == "" {
+		return fileName
+	}
+	return fileName + "#" + fragment
+}
+
+// Alias maps alias url to the file of the canonical page, links to the alias then lead to the canonical file.
+func (this *PathProcessor) Alias(alias url.URL, canonical ProcessedPath) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	canonical.Url.Fragment = ""
+	canonical.RelativeUrl = canonical.LocalPath
+	key := this.Canonicalizer.Key(alias)
+	this.urlToFile[key] = canonical.LocalPath
+	this.canonicals[key] = canonical
+}
+
+// CanonicalOf returns canonical page of the url, if the url was marked as its alias.
+func (this *PathProcessor) CanonicalOf(link url.URL) (ProcessedPath, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	canonical, ok := this.canonicals[this.Canonicalizer.Key(link)]
+	return canonical, ok
+}
+
+// Mappings returns copy of already assigned url to file mapping, aliases are returned by Aliases.
+func (this *PathProcessor) Mappings() map[string]string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	mappings := make(map[string]string, len(this.urlToFile))
+	for url, file := range this.urlToFile {
+		if _, isAlias := this.canonicals[url]; !isAlias {
+			mappings[url] = file
+		}
+	}
+	return mappings
+}
+
+// Aliases returns copy of alias url to canonical page mapping.
+func (this *PathProcessor) Aliases() map[string]ProcessedPath {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	aliases := make(map[string]ProcessedPath, len(this.canonicals))
+	for url, canonical := range this.canonicals {
+		aliases[url] = canonical
+	}
+	return aliases
+}
+
+// Assign maps the url to already assigned file, the file then belongs to the url.
+func (this *PathProcessor) Assign(link url.URL, fileName string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.assign(this.Canonicalizer.Key(link), fileName)
+}
+
+func (this *PathProcessor) assign(key string, fileName string) {
+	this.urlToFile[key] = fileName
+	this.fileToUrl[fileName] = key
+	this.addDirectories(fileName)
+}
+
+func (this *PathProcessor) addDirectories(fileName string) {
+	for directory := filepath.Dir(fileName); directory != "." && directory != string(filepath.Separator); directory = filepath.Dir(directory) {
+		this.directories[directory] = true
+	}
+}
+
+// SetLocation changes location of the crawl root, used when the root is redirected.
+func (this *PathProcessor) SetLocation(location *url.URL) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.Location = location
+}
+
+// Files returns copy of assigned file to url mapping, including files of pages that became aliases.
+func (this *PathProcessor) Files() map[string]string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	files := make(map[string]string, len(this.fileToUrl))
+	for file, url := range this.fileToUrl {
+		files[file] = url
+	}
+	return files
+}
+
+// Restore loads url to file and file to url mappings from previous run, aliases are restored by Alias.
+// Files may be nil for state of older runs, it is derived from the mappings then.
+func (this *PathProcessor) Restore(mappings map[string]string, files map[string]string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for url, file := range mappings {
+		this.urlToFile[url] = file
+		if files == nil {
+			this.fileToUrl[file] = url
+		}
+		this.addDirectories(file)
+	}
+	for file, url := range files {
+		this.fileToUrl[file] = url
+		this.addDirectories(file)
 	}
 }
@@ -0,0 +1,114 @@
+package parsers
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+)
+
+func TestWithQuerySuffix(t *testing.T) {
+	tests := []struct {
+		fileName string
+		rawQuery string
+		want     string
+	}{
+		{"index.html", "", "index.html"},
+		{"index.html", "page=1", "index_page-1.html"},
+		{"list.html", "page=2&sort=name", "list_page-2_sort-name.html"},
+		{"style", "v=3.1", "style_v-3.1"},
+		{"docs/page.html", "id=5", "docs/page_id-5.html"},
+	}
+	for _, test := range tests {
+		if got := withQuerySuffix(test.fileName, test.rawQuery); got != test.want {
+			t.Errorf("withQuerySuffix(%q, %q) = %q, want %q", test.fileName, test.rawQuery, got, test.want)
+		}
+	}
+
+	hashed := []string{
+		"x=1-2",
+		"x-1=2",
+		"a_b=1",
+		"q=a%20b",
+		"name=" + strings.Repeat("a", 40),
+	}
+	seen := map[string]string{}
+	for _, rawQuery := range hashed {
+		got := withQuerySuffix("page.html", rawQuery)
+		if !strings.HasPrefix(got, "page_q") || !strings.HasSuffix(got, ".html") || len(got) != len("page_q0123456789.html") {
+			t.Errorf("withQuerySuffix(%q, %q) = %q, want hashed suffix", "page.html", rawQuery, got)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("withQuerySuffix maps both %q and %q to %q", other, rawQuery, got)
+		}
+		seen[got] = rawQuery
+	}
+}
+
+func TestTreeFileName(t *testing.T) {
+	location, _ := url.Parse("http://example.com/docs/")
+	tree := &PathProcessor{Location: location, Layout: config.LayoutTree}
+	treeHost := &PathProcessor{Location: location, Layout: config.LayoutTreeHost}
+	tests := []struct {
+		processor *PathProcessor
+		link      string
+		want      string
+	}{
+		{tree, "http://example.com/", "index.html"},
+		{tree, "http://example.com/docs/", "docs/index.html"},
+		{tree, "http://example.com/docs/intro", "docs/intro/index.html"},
+		{tree, "http://example.com/docs/intro/", "docs/intro/index.html"},
+		{tree, "http://example.com/docs/page.html", "docs/page.html"},
+		{tree, "http://example.com/docs/v1.2/", "docs/v1.2/index.html"},
+		{tree, "http://example.com/docs/v1.2", "docs/v1.2/index.html"},
+		{tree, "http://example.com/docs/archive.tar.gz", "docs/archive.tar.gz"},
+		{tree, "http://example.com/docs/list.html?page=2", "docs/list_page-2.html"},
+		{tree, "http://example.com/docs/?page=2", "docs/index_page-2.html"},
+		{tree, "http://example.com/%2e%2e/%2e%2e/etc/passwd.html", "etc/passwd.html"},
+		{tree, "http://example.com/docs/../../x.html", "x.html"},
+		{tree, "http://cdn.example.com:8080/img/logo.png", "cdn.example.com_8080/img/logo.png"},
+		{treeHost, "http://example.com/docs/page.html", "example.com/docs/page.html"},
+		{treeHost, "http://Example.com/", "example.com/index.html"},
+	}
+	for _, test := range tests {
+		link, err := url.Parse(test.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := test.processor.treeFileName(link)
+		if filepath.ToSlash(got) != test.want {
+			t.Errorf("treeFileName(%q) with layout %s = %q, want %q", test.link, test.processor.Layout, got, test.want)
+		}
+		if !filepath.IsLocal(got) {
+			t.Errorf("treeFileName(%q) = %q is outside of the output directory", test.link, got)
+		}
+	}
+}
+
+func TestHandlePathTreeCollisions(t *testing.T) {
+	location, _ := url.Parse("http://example.com/")
+	args := config.Default()
+	args.Layout = config.LayoutTree
+	processor := NewPathProcessor(zap.NewNop().Sugar(), location, &args)
+
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"http://example.com/docs/intro", "docs/intro/index.html"},
+		{"http://example.com/docs/intro/", "docs/intro/index_7a0410de.html"},
+		{"http://example.com/docs/intro", "docs/intro/index.html"},
+		{"http://example.com/docs/guide.png/part.html", "docs/guide.png/part.html"},
+		{"http://example.com/docs/guide.png", "docs/guide_e8bf161e.png"},
+	}
+	for _, test := range tests {
+		processed := processor.HandlePath(test.link, *location, ".")
+		if !processed.Success || filepath.ToSlash(processed.LocalPath) != test.want {
+			t.Errorf("HandlePath(%q) = %q, want %q", test.link, processed.LocalPath, test.want)
+		}
+	}
+}
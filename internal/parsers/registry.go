@@ -0,0 +1,168 @@
+package parsers
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+)
+
+// Factory creates new parser for every processed document, parsers may therefore keep per-document state.
+type Factory func(logger *zap.SugaredLogger, args *config.Config, pathProcessor *PathProcessor) Parser
+
+type Registration struct {
+	// Name identifies the registration, registering the same name again replaces the previous one.
+	Name string
+	// MimeTypes are patterns in path.Match syntax matched against content type without parameters, e.g. "image/*".
+	MimeTypes []string
+	// Extensions of the url path including the dot, e.g. ".css", used when no registration matches the content type.
+	Extensions []string
+	// UrlPatterns are matched against the full url, used when no registration matches the content type.
+	UrlPatterns []*regexp.Regexp
+	// Priority decides between multiple registrations matching the same way, higher wins.
+	Priority int
+	// Streamable parsers store the content unchanged, the content is then streamed to disk and never parsed.
+	Streamable bool
+	Factory    Factory
+}
+
+const (
+	noMatch = iota
+	locationMatch
+	mimeMatch
+)
+
+type Registry struct {
+	mutex         sync.RWMutex
+	registrations []Registration
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		mutex:         sync.RWMutex{},
+		registrations: make([]Registration, 0),
+	}
+}
+
+// NewDefaultRegistry returns registry with the built-in parsers.
+func NewDefaultRegistry() *Registry {
+	registry := NewRegistry()
+	registry.Register(Registration{
+		Name:      "html",
+		MimeTypes: []string{"text/html", "application/xhtml+xml"},
+		Factory: func(logger *zap.SugaredLogger, args *config.Config, pathProcessor *PathProcessor) Parser {
+			return &HtmlParser{Logger: logger, Args: args, PathProcessor: pathProcessor}
+		},
+	})
+	registry.Register(Registration{
+		Name:      "css",
+		MimeTypes: []string{"text/css"},
+		Factory: func(logger *zap.SugaredLogger, _ *config.Config, pathProcessor *PathProcessor) Parser {
+			return &CssParser{Logger: logger, PathProcessor: pathProcessor}
+		},
+	})
+	registry.Register(Registration{
+		Name:      "javascript",
+		MimeTypes: []string{"*/javascript", "*/x-javascript", "*/ecmascript"},
+		Factory: func(_ *zap.SugaredLogger, _ *config.Config, _ *PathProcessor) Parser {
+			return &JavaScriptParser{}
+		},
+	})
+	registry.Register(Registration{
+		Name:       "passthrough",
+		MimeTypes:  []string{"image/*", "font/*", "video/*"},
+		Streamable: true,
+		Factory: func(_ *zap.SugaredLogger, _ *config.Config, _ *PathProcessor) Parser {
+			return &PassthroughParser{}
+		},
+	})
+	return registry
+}
+
+func (this *Registry) Register(registration Registration) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for i, existing := range this.registrations {
+		if existing.Name == registration.Name {
+			this.registrations[i] = registration
+			return
+		}
+	}
+	this.registrations = append(this.registrations, registration)
+}
+
+// Unregister disables the parser with given name, e.g. "html" or "css" for the built-in ones.
+func (this *Registry) Unregister(name string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for i, existing := range this.registrations {
+		if existing.Name == name {
+			this.registrations = append(this.registrations[:i], this.registrations[i+1:]...)
+			return
+		}
+	}
+}
+
+// matches returns how the registration matches, content type match is stronger than extension or url match.
+func (this *Registration) matches(mediaType string, location url.URL) int {
+	for _, pattern := range this.MimeTypes {
+		if matched, _ := path.Match(pattern, mediaType); matched {
+			return mimeMatch
+		}
+	}
+	extension := strings.ToLower(path.Ext(location.Path))
+	for _, candidate := range this.Extensions {
+		if extension != "" && strings.ToLower(candidate) == extension {
+			return locationMatch
+		}
+	}
+	for _, pattern := range this.UrlPatterns {
+		if pattern.MatchString(location.String()) {
+			return locationMatch
+		}
+	}
+	return noMatch
+}
+
+// Find returns the registration used for the content. Registrations matching the content type win over
+// those matching extension or url, then the highest priority wins and later registration wins on equal priority.
+func (this *Registry) Find(contentType string, location url.URL) (Registration, bool) {
+	mediaType := MediaType(contentType)
+
+	// The registration is copied, registering may reallocate the slice once the lock is released
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	var best Registration
+	bestMatch := noMatch
+	for _, registration := range this.registrations {
+		match := registration.matches(mediaType, location)
+		if match == noMatch || match < bestMatch {
+			continue
+		}
+		if match > bestMatch || registration.Priority >= best.Priority {
+			best = registration
+			bestMatch = match
+		}
+	}
+	return best, bestMatch != noMatch
+}
+
+// Get returns new parser of the registration returned by Find, nil when no registration matches.
+func (this *Registry) Get(
+	contentType string,
+	location url.URL,
+	logger *zap.SugaredLogger,
+	args *config.Config,
+	pathProcessor *PathProcessor,
+) Parser {
+	registration, found := this.Find(contentType, location)
+	if !found {
+		return nil
+	}
+	return registration.Factory(logger, args, pathProcessor)
+}
@@ -0,0 +1,44 @@
+package parsers
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestRegistryFind(t *testing.T) {
+	registry := NewDefaultRegistry()
+	registry.Register(Registration{Name: "json", MimeTypes: []string{"application/json"}, Extensions: []string{".json"}})
+	registry.Register(Registration{Name: "api", UrlPatterns: []*regexp.Regexp{regexp.MustCompile(`/api/`)}, Priority: 10})
+	registry.Register(Registration{Name: "svg", MimeTypes: []string{"image/svg+xml"}, Priority: 1})
+
+	tests := []struct {
+		contentType string
+		link        string
+		want        string
+		streamable  bool
+	}{
+		{"text/html; charset=utf-8", "http://site/page.html", "html", false},
+		{"text/html", "http://site/api.json", "html", false},
+		{"text/html", "http://site/api/page", "html", false},
+		{"application/octet-stream", "http://site/data.json", "json", false},
+		{"application/json", "http://site/data", "json", false},
+		{"text/plain", "http://site/api/data", "api", false},
+		{"image/png", "http://site/logo.png", "passthrough", true},
+		{"image/svg+xml", "http://site/logo.svg", "svg", false},
+		{"text/plain", "http://site/readme.txt", "", false},
+	}
+	for _, test := range tests {
+		link, err := url.Parse(test.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		registration, found := registry.Find(test.contentType, *link)
+		if !found && test.want != "" || found && registration.Name != test.want {
+			t.Errorf("Find(%q, %q) = %q, want %q", test.contentType, test.link, registration.Name, test.want)
+		}
+		if registration.Streamable != test.streamable {
+			t.Errorf("Find(%q, %q).Streamable = %v, want %v", test.contentType, test.link, registration.Streamable, test.streamable)
+		}
+	}
+}
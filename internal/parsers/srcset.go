@@ -0,0 +1,74 @@
+package parsers
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type srcsetCandidate struct {
+	Url        string
+	Descriptor string
+}
+
+// parseSrcset splits srcset attribute into candidates, urls may contain commas so they are delimited by whitespace.
+func parseSrcset(srcset string) []srcsetCandidate {
+	candidates := make([]srcsetCandidate, 0)
+	rest := srcset
+	for {
+		rest = strings.TrimLeftFunc(rest, func(r rune) bool {
+			return unicode.IsSpace(r) || r == ','
+		})
+		if rest == "" {
+			return candidates
+		}
+
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+		link := rest[:end]
+		rest = rest[end:]
+
+		descriptor := ""
+		if strings.HasSuffix(link, ",") {
+			link = strings.TrimRight(link, ",")
+		} else {
+			comma := strings.Index(rest, ",")
+			if comma < 0 {
+				comma = len(rest)
+			}
+			descriptor = strings.TrimSpace(rest[:comma])
+			rest = rest[comma:]
+		}
+		candidates = append(candidates, srcsetCandidate{Url: link, Descriptor: descriptor})
+	}
+}
+
+// largestSrcsetCandidate picks candidate with the biggest width or pixel density descriptor, inline images are preferred last.
+func largestSrcsetCandidate(candidates []srcsetCandidate) srcsetCandidate {
+	best := candidates[0]
+	bestSize := srcsetSize(best)
+	for _, candidate := range candidates[1:] {
+		size := srcsetSize(candidate)
+		bestInline := strings.HasPrefix(best.Url, "data:")
+		inline := strings.HasPrefix(candidate.Url, "data:")
+		if (bestInline && !inline) || (bestInline == inline && size > bestSize) {
+			best = candidate
+			bestSize = size
+		}
+	}
+	return best
+}
+
+func srcsetSize(candidate srcsetCandidate) float64 {
+	descriptor := strings.ToLower(candidate.Descriptor)
+	if descriptor == "" {
+		return 1
+	}
+	size, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64)
+	if err != nil {
+		return 0
+	}
+	return size
+}
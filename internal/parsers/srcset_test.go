@@ -0,0 +1,64 @@
+package parsers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   []srcsetCandidate
+	}{
+		{"", []srcsetCandidate{}},
+		{"  ,  ", []srcsetCandidate{}},
+		{"image.png", []srcsetCandidate{{Url: "image.png"}}},
+		{"small.png 1x, large.png 2x", []srcsetCandidate{
+			{Url: "small.png", Descriptor: "1x"},
+			{Url: "large.png", Descriptor: "2x"},
+		}},
+		{"small.png 480w,large.png 1080w", []srcsetCandidate{
+			{Url: "small.png", Descriptor: "480w"},
+			{Url: "large.png", Descriptor: "1080w"},
+		}},
+		{"a.png, b.png 2x", []srcsetCandidate{
+			{Url: "a.png"},
+			{Url: "b.png", Descriptor: "2x"},
+		}},
+		{"\n\timage,w_100.png 100w,\n\timage,w_200.png 200w\n", []srcsetCandidate{
+			{Url: "image,w_100.png", Descriptor: "100w"},
+			{Url: "image,w_200.png", Descriptor: "200w"},
+		}},
+		{"data:image/png;base64,iVBORw0KGgo= 1x, full.png 2x", []srcsetCandidate{
+			{Url: "data:image/png;base64,iVBORw0KGgo=", Descriptor: "1x"},
+			{Url: "full.png", Descriptor: "2x"},
+		}},
+	}
+	for _, test := range tests {
+		if got := parseSrcset(test.srcset); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseSrcset(%q) = %v, want %v", test.srcset, got, test.want)
+		}
+	}
+}
+
+func TestLargestSrcsetCandidate(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   string
+	}{
+		{"image.png", "image.png"},
+		{"small.png 1x, large.png 2x", "large.png"},
+		{"large.png 2x, small.png 1x", "large.png"},
+		{"small.png 480w, large.png 1080w, medium.png 720w", "large.png"},
+		{"default.png, large.png 1.5x", "large.png"},
+		{"default.png, small.png 0.5x", "default.png"},
+		{"broken.png 2.x.5x, valid.png 1x", "valid.png"},
+		{"data:image/png;base64,AAAA 4x, real.png 1x", "real.png"},
+		{"data:image/png;base64,AAAA 1x, data:image/png;base64,BBBB 2x", "data:image/png;base64,BBBB"},
+	}
+	for _, test := range tests {
+		if got := largestSrcsetCandidate(parseSrcset(test.srcset)).Url; got != test.want {
+			t.Errorf("largestSrcsetCandidate(%q) = %q, want %q", test.srcset, got, test.want)
+		}
+	}
+}
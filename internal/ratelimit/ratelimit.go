@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+)
+
+type host struct {
+	slots      chan struct{}
+	delay      time.Duration
+	nextAccess time.Time
+}
+
+type Limiter struct {
+	Default config.HostLimit
+	Limits  []config.HostLimit
+	mutex   sync.Mutex
+	hosts   map[string]*host
+}
+
+func NewLimiter(defaultLimit config.HostLimit, limits []config.HostLimit) *Limiter {
+	return &Limiter{
+		Default: defaultLimit,
+		Limits:  limits,
+		mutex:   sync.Mutex{},
+		hosts:   make(map[string]*host),
+	}
+}
+
+func (this *Limiter) limitFor(hostname string) config.HostLimit {
+	for _, limit := range this.Limits {
+		if matched, _ := path.Match(limit.Pattern, hostname); matched {
+			return limit
+		}
+	}
+	return this.Default
+}
+
+func (this *Limiter) hostFor(hostname string) *host {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if h, ok := this.hosts[hostname]; ok {
+		return h
+	}
+	limit := this.limitFor(hostname)
+	h := &host{delay: limit.Delay}
+	if limit.Concurrency > 0 {
+		h.slots = make(chan struct{}, limit.Concurrency)
+	}
+	this.hosts[hostname] = h
+	return h
+}
+
+// Acquire blocks until a request to the host may be sent.
+// The returned function must be called once the request finishes.
+func (this *Limiter) Acquire(ctx context.Context, hostname string) (func(), error) {
+	h := this.hostFor(strings.ToLower(hostname))
+
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if h.slots != nil {
+			<-h.slots
+		}
+	}
+
+	if h.delay > 0 {
+		this.mutex.Lock()
+		now := time.Now()
+		access := h.nextAccess
+		if access.Before(now) {
+			access = now
+		}
+		h.nextAccess = access.Add(h.delay)
+		this.mutex.Unlock()
+
+		select {
+		case <-time.After(time.Until(access)):
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+)
+
+func TestLimitFor(t *testing.T) {
+	limiter := NewLimiter(
+		config.HostLimit{Pattern: "*", Concurrency: 2},
+		[]config.HostLimit{
+			{Pattern: "cdn.example.com", Concurrency: 8},
+			{Pattern: "*.example.com", Concurrency: 1, Delay: time.Second},
+		},
+	)
+	tests := []struct {
+		hostname    string
+		concurrency uint32
+		delay       time.Duration
+	}{
+		{"cdn.example.com", 8, 0},
+		{"www.example.com", 1, time.Second},
+		{"example.com", 2, 0},
+		{"other.org", 2, 0},
+	}
+	for _, test := range tests {
+		limit := limiter.limitFor(test.hostname)
+		if limit.Concurrency != test.concurrency || limit.Delay != test.delay {
+			t.Errorf("limitFor(%q) = %+v, want concurrency %d and delay %v", test.hostname, limit, test.concurrency, test.delay)
+		}
+	}
+}
+
+func TestAcquireDelay(t *testing.T) {
+	delay := 40 * time.Millisecond
+	limiter := NewLimiter(config.HostLimit{Pattern: "*", Delay: delay}, nil)
+	ctx := context.Background()
+
+	start := time.Now()
+	var accesses []time.Duration
+	for i := 0; i < 3; i++ {
+		release, err := limiter.Acquire(ctx, "Example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		accesses = append(accesses, time.Since(start))
+		release()
+	}
+	for i, access := range accesses {
+		if minimum := time.Duration(i) * delay; access < minimum {
+			t.Errorf("Access %d after %v, want at least %v", i, access, minimum)
+		}
+	}
+
+	// Other hosts are not delayed by example.com
+	otherStart := time.Now()
+	release, err := limiter.Acquire(ctx, "other.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if waited := time.Since(otherStart); waited >= delay {
+		t.Errorf("First access to other host waited %v", waited)
+	}
+}
+
+func TestAcquireConcurrency(t *testing.T) {
+	limiter := NewLimiter(config.HostLimit{Pattern: "*", Concurrency: 1}, nil)
+	release, err := limiter.Acquire(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, "example.com"); err == nil {
+		t.Error("Second slot acquired while the first one is held")
+	}
+
+	release()
+	second, err := limiter.Acquire(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Slot not acquired after release: %v", err)
+	}
+	second()
+}
@@ -0,0 +1,139 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/PatrikValkovic/scrappy/internal/download"
+)
+
+type hostEntry struct {
+	ready      chan struct{}
+	rules      *Rules
+	nextAccess time.Time
+}
+
+type Checker struct {
+	Logger      *zap.SugaredLogger
+	Client      *download.Client
+	UserAgent   string
+	IgnoreHosts []string
+	mutex       sync.Mutex
+	hosts       map[string]*hostEntry
+}
+
+func NewChecker(
+	logger *zap.SugaredLogger,
+	client *download.Client,
+	userAgent string,
+	ignoreHosts []string,
+) *Checker {
+	return &Checker{
+		Logger:      logger,
+		Client:      client,
+		UserAgent:   userAgent,
+		IgnoreHosts: ignoreHosts,
+		mutex:       sync.Mutex{},
+		hosts:       make(map[string]*hostEntry),
+	}
+}
+
+func (this *Checker) isIgnored(host string) bool {
+	for _, ignored := range this.IgnoreHosts {
+		if ignored == "*" || strings.EqualFold(ignored, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesFor returns the rules of the host, robots.txt is downloaded on the first request of the host.
+func (this *Checker) rulesFor(ctx context.Context, link url.URL) (*Rules, error) {
+	key := link.Scheme + "://" + strings.ToLower(link.Host)
+	this.mutex.Lock()
+	entry, exists := this.hosts[key]
+	if !exists {
+		entry = &hostEntry{ready: make(chan struct{})}
+		this.hosts[key] = entry
+	}
+	this.mutex.Unlock()
+
+	if exists {
+		select {
+		case <-entry.ready:
+			return entry.rules, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	defer close(entry.ready)
+	robotsUrl := url.URL{Scheme: link.Scheme, Host: link.Host, Path: "/robots.txt"}
+	response, err := this.Client.Download(ctx, robotsUrl, download.Validators{})
+	var statusErr *download.StatusError
+	switch {
+	case err == nil:
+		this.Logger.Debugf("Loaded %s", robotsUrl.String())
+		entry.rules = Parse(response.Content).ForAgent(this.UserAgent)
+	case errors.As(err, &statusErr) && statusErr.StatusCode < 500:
+		this.Logger.Debugf("No robots.txt for %s: %v", key, err)
+		entry.rules = &Rules{}
+	default:
+		this.Logger.Warnf("Could not download %s, assuming everything is allowed: %v", robotsUrl.String(), err)
+		entry.rules = &Rules{}
+	}
+	return entry.rules, nil
+}
+
+func (this *Checker) Allowed(ctx context.Context, link url.URL) (bool, error) {
+	if this.isIgnored(link.Hostname()) {
+		return true, nil
+	}
+	rules, err := this.rulesFor(ctx, link)
+	if err != nil {
+		return false, err
+	}
+	return rules.Allowed(link), nil
+}
+
+func (this *Checker) CrawlDelay(ctx context.Context, link url.URL) (time.Duration, error) {
+	if this.isIgnored(link.Hostname()) {
+		return 0, nil
+	}
+	rules, err := this.rulesFor(ctx, link)
+	if err != nil {
+		return 0, err
+	}
+	return rules.CrawlDelay, nil
+}
+
+// Wait blocks until the Crawl-delay of the host since the previous request has passed.
+func (this *Checker) Wait(ctx context.Context, link url.URL) error {
+	delay, err := this.CrawlDelay(ctx, link)
+	if err != nil || delay == 0 {
+		return err
+	}
+
+	this.mutex.Lock()
+	entry := this.hosts[link.Scheme+"://"+strings.ToLower(link.Host)]
+	now := time.Now()
+	access := entry.nextAccess
+	if access.Before(now) {
+		access = now
+	}
+	entry.nextAccess = access.Add(delay)
+	this.mutex.Unlock()
+
+	select {
+	case <-time.After(time.Until(access)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,164 @@
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+type Robots struct {
+	groups []*group
+}
+
+// Rules is the subset of robots.txt applicable to a single user agent.
+type Rules struct {
+	rules      []rule
+	CrawlDelay time.Duration
+}
+
+func Parse(content []byte) *Robots {
+	robots := &Robots{}
+	var current *group
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if current == nil || !lastWasAgent {
+				current = &group{}
+				robots.groups = append(robots.groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+		case "allow", "disallow":
+			lastWasAgent = false
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			lastWasAgent = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		default:
+			lastWasAgent = false
+		}
+	}
+	return robots
+}
+
+// ForAgent merges all groups whose user-agent token is the most specific match of userAgent,
+// falling back to the "*" groups.
+func (this *Robots) ForAgent(userAgent string) *Rules {
+	userAgent = strings.ToLower(userAgent)
+	bestLength := -1
+	var matching []*group
+	for _, g := range this.groups {
+		for _, agent := range g.agents {
+			length := -1
+			if agent == "*" {
+				length = 0
+			} else if agent != "" && strings.Contains(userAgent, agent) {
+				length = len(agent)
+			}
+			if length < 0 || length < bestLength {
+				continue
+			}
+			if length > bestLength {
+				bestLength = length
+				matching = matching[:0]
+			}
+			matching = append(matching, g)
+			break
+		}
+	}
+
+	rules := &Rules{}
+	for _, g := range matching {
+		rules.rules = append(rules.rules, g.rules...)
+		if g.crawlDelay > rules.CrawlDelay {
+			rules.CrawlDelay = g.crawlDelay
+		}
+	}
+	return rules
+}
+
+// Allowed evaluates the longest matching rule, Allow wins ties.
+func (this *Rules) Allowed(link url.URL) bool {
+	path := link.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if link.RawQuery != "" {
+		path = path + "?" + link.RawQuery
+	}
+
+	allowed := true
+	matchedLength := -1
+	for _, r := range this.rules {
+		if !matches(r.pattern, path) {
+			continue
+		}
+		if len(r.pattern) > matchedLength || (len(r.pattern) == matchedLength && r.allow) {
+			matchedLength = len(r.pattern)
+			allowed = r.allow
+		}
+	}
+	return allowed
+}
+
+func matches(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	position := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path[position:], part)
+		}
+		index := strings.Index(path[position:], part)
+		if index < 0 {
+			return false
+		}
+		position += index + len(part)
+	}
+	return !anchored || position == len(path)
+}
@@ -0,0 +1,95 @@
+package robots
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/", true},
+		{"/", "/page.html", true},
+		{"/private", "/private/page.html", true},
+		{"/private", "/public/page.html", false},
+		{"/private/", "/private", false},
+		{"/*.pdf", "/docs/file.pdf", true},
+		{"/*.pdf", "/docs/file.pdf?download=1", true},
+		{"/*.pdf$", "/docs/file.pdf", true},
+		{"/*.pdf$", "/docs/file.pdf?download=1", false},
+		{"/*.pdf$", "/docs/file.pdf.pdf", true},
+		{"/page$", "/page", true},
+		{"/page$", "/page/", false},
+		{"/a*b*c", "/a-b-c", true},
+		{"/a*b*c", "/a-c-b", false},
+		{"/*?", "/page?x=1", true},
+		{"/*?", "/page", false},
+		{"*", "/anything", true},
+	}
+	for _, test := range tests {
+		if got := matches(test.pattern, test.path); got != test.want {
+			t.Errorf("matches(%q, %q) = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func TestRulesAllowed(t *testing.T) {
+	content := []byte(`
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+Crawl-delay: 2
+
+# scrappy has its own group
+User-agent: scrappy
+User-agent: other
+Disallow: /
+Allow: /docs/
+Allow: /page
+Disallow: /page
+Crawl-delay: 0.5
+`)
+	robots := Parse(content)
+
+	tests := []struct {
+		agent string
+		link  string
+		want  bool
+	}{
+		{"Mozilla/5.0", "http://site/", true},
+		{"Mozilla/5.0", "http://site/private/page.html", false},
+		{"Mozilla/5.0", "http://site/private/public/page.html", true},
+		{"Mozilla/5.0", "http://site/file.pdf", false},
+		{"Mozilla/5.0", "http://site/file.pdf?x=1", true},
+		{"Mozilla/5.0", "http://site/search", true},
+		{"Mozilla/5.0", "http://site/search?q=1", false},
+		{"Mozilla/5.0", "http://site/robots.txt", true},
+		{"scrappy (+https://github.com/PatrikValkovic/scrappy)", "http://site/", false},
+		{"scrappy (+https://github.com/PatrikValkovic/scrappy)", "http://site/docs/page.html", true},
+		{"scrappy (+https://github.com/PatrikValkovic/scrappy)", "http://site/page", true},
+		{"scrappy (+https://github.com/PatrikValkovic/scrappy)", "http://site/robots.txt", true},
+		{"Other", "http://site/private/page.html", false},
+	}
+	for _, test := range tests {
+		link, err := url.Parse(test.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := robots.ForAgent(test.agent).Allowed(*link); got != test.want {
+			t.Errorf("ForAgent(%q).Allowed(%q) = %v, want %v", test.agent, test.link, got, test.want)
+		}
+	}
+
+	if delay := robots.ForAgent("Mozilla/5.0").CrawlDelay; delay != 2*time.Second {
+		t.Errorf("CrawlDelay of * group = %v, want 2s", delay)
+	}
+	if delay := robots.ForAgent("scrappy").CrawlDelay; delay != 500*time.Millisecond {
+		t.Errorf("CrawlDelay of scrappy group = %v, want 500ms", delay)
+	}
+}
@@ -0,0 +1,105 @@
+package sniff
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+)
+
+// HeadSize is the number of bytes needed for detection.
+const HeadSize = 512
+
+// genericTypes say nothing about the content, servers send them when they do not know better.
+var genericTypes = map[string]bool{
+	"":                         true,
+	"text/plain":               true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+	"application/unknown":      true,
+	"application/x-unknown":    true,
+}
+
+type magic struct {
+	offset      int
+	prefix      []byte
+	contentType string
+}
+
+// magics are signatures not recognized by http.DetectContentType.
+var magics = []magic{
+	{offset: 0, prefix: []byte("7z\xBC\xAF\x27\x1C"), contentType: "application/x-7z-compressed"},
+	{offset: 4, prefix: []byte("ftypavif"), contentType: "image/avif"},
+	{offset: 0, prefix: []byte("<svg"), contentType: "image/svg+xml"},
+}
+
+// Sniffer decides the content type of responses according to the policy, one of config.SniffNever,
+// config.SniffMissing, config.SniffGeneric or config.SniffAlways.
+type Sniffer struct {
+	Policy string
+}
+
+func New(policy string) *Sniffer {
+	return &Sniffer{
+		Policy: policy,
+	}
+}
+
+// ContentType returns the header or the type detected from the beginning of the content, when the policy allows it.
+// Charset of the header is kept, because the detection can not recognize it.
+func (this *Sniffer) ContentType(location url.URL, header string, head []byte) string {
+	mediaType, params := parse(header)
+	switch this.Policy {
+	case config.SniffNever:
+		return header
+	case config.SniffMissing:
+		if mediaType != "" {
+			return header
+		}
+	case config.SniffGeneric:
+		if !genericTypes[mediaType] {
+			return header
+		}
+	}
+
+	sniffed := Detect(location, head)
+	if sniffed == mediaType || (genericTypes[sniffed] && mediaType != "") {
+		return header
+	}
+	if charset, ok := params["charset"]; ok {
+		return mime.FormatMediaType(sniffed, map[string]string{"charset": charset})
+	}
+	return sniffed
+}
+
+// Detect returns media type based on magic bytes and the url extension.
+func Detect(location url.URL, head []byte) string {
+	trimmed := bytes.TrimLeft(head, " \t\r\n")
+	for _, signature := range magics {
+		if len(trimmed) >= signature.offset+len(signature.prefix) &&
+			bytes.Equal(trimmed[signature.offset:signature.offset+len(signature.prefix)], signature.prefix) {
+			return signature.contentType
+		}
+	}
+
+	detected, _ := parse(http.DetectContentType(head))
+	if !genericTypes[detected] && detected != "text/xml" {
+		return detected
+	}
+	if byExtension, _ := parse(mime.TypeByExtension(strings.ToLower(path.Ext(location.Path)))); byExtension != "" {
+		return byExtension
+	}
+	return detected
+}
+
+func parse(contentType string) (string, map[string]string) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0])), map[string]string{}
+	}
+	return strings.ToLower(mediaType), params
+}
@@ -0,0 +1,80 @@
+package sniff
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+)
+
+var (
+	pngHead  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	htmlHead = []byte("<!DOCTYPE html><html><head><title>Page</title></head>")
+	textHead = []byte("plain words without any markup")
+)
+
+func TestSnifferContentType(t *testing.T) {
+	tests := []struct {
+		policy string
+		link   string
+		header string
+		head   []byte
+		want   string
+	}{
+		// Never keeps the header
+		{config.SniffNever, "http://site/logo", "", pngHead, ""},
+		{config.SniffNever, "http://site/logo", "application/octet-stream", pngHead, "application/octet-stream"},
+
+		// Missing sniffs only responses without the header
+		{config.SniffMissing, "http://site/logo", "", pngHead, "image/png"},
+		{config.SniffMissing, "http://site/logo", "application/octet-stream", pngHead, "application/octet-stream"},
+		{config.SniffMissing, "http://site/page", "text/html", pngHead, "text/html"},
+
+		// Generic sniffs also generic headers, the charset is kept
+		{config.SniffGeneric, "http://site/logo", "", pngHead, "image/png"},
+		{config.SniffGeneric, "http://site/logo", "application/octet-stream", pngHead, "image/png"},
+		{config.SniffGeneric, "http://site/page", "text/plain; charset=windows-1250", htmlHead, "text/html; charset=windows-1250"},
+		{config.SniffGeneric, "http://site/page", "text/html", pngHead, "text/html"},
+		{config.SniffGeneric, "http://site/notes", "text/plain", textHead, "text/plain"},
+
+		// Always overrides specific headers as well
+		{config.SniffAlways, "http://site/page", "text/html", pngHead, "image/png"},
+		{config.SniffAlways, "http://site/page", "text/html; charset=utf-8", htmlHead, "text/html; charset=utf-8"},
+		{config.SniffAlways, "http://site/style.css", "text/css", textHead, "text/css"},
+		{config.SniffAlways, "http://site/notes", "", textHead, "text/plain"},
+	}
+	for _, test := range tests {
+		link, err := url.Parse(test.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := New(test.policy).ContentType(*link, test.header, test.head); got != test.want {
+			t.Errorf("%s: ContentType(%q, %q) = %q, want %q", test.policy, test.link, test.header, got, test.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		link string
+		head []byte
+		want string
+	}{
+		{"http://site/logo", pngHead, "image/png"},
+		{"http://site/page", htmlHead, "text/html"},
+		{"http://site/icon", []byte("  <svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), "image/svg+xml"},
+		{"http://site/archive", []byte("7z\xBC\xAF\x27\x1C\x00\x04"), "application/x-7z-compressed"},
+		{"http://site/photo", []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00"), "image/avif"},
+		{"http://site/style.css", textHead, "text/css"},
+		{"http://site/data.bin", []byte{0x00, 0x01, 0x02, 0x03}, "application/octet-stream"},
+	}
+	for _, test := range tests {
+		link, err := url.Parse(test.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Detect(*link, test.head); got != test.want {
+			t.Errorf("Detect(%q) = %q, want %q", test.link, got, test.want)
+		}
+	}
+}
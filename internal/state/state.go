@@ -0,0 +1,154 @@
+package state
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/PatrikValkovic/scrappy/internal/canonical"
+	"github.com/PatrikValkovic/scrappy/internal/parsers"
+)
+
+const FileName = ".scrappy-state.json"
+
+type Entry struct {
+	Url        string `json:"url"`
+	IsRequired bool   `json:"isRequired"`
+	FileName   string `json:"fileName"`
+	Depth      uint64 `json:"depth"`
+}
+
+// Alias is a page stored under the file of its canonical page.
+type Alias struct {
+	Url      string `json:"url"`
+	FileName string `json:"fileName"`
+}
+
+type State struct {
+	ParseRoot string            `json:"parseRoot"`
+	Frontier  []Entry           `json:"frontier"`
+	Visited   []string          `json:"visited"`
+	UrlToFile map[string]string `json:"urlToFile"`
+	// FileToUrl contains also files of pages that became aliases, it is missing in state of older runs.
+	FileToUrl map[string]string `json:"fileToUrl,omitempty"`
+	// Aliases maps alias url to its canonical page.
+	Aliases map[string]Alias `json:"aliases,omitempty"`
+}
+
+// Tracker keeps track of downloads that were claimed by a downloader and downloads that were not finished yet,
+// so that the crawl can be checkpointed at any moment. Urls are keyed by their canonical form.
+type Tracker struct {
+	Canonicalizer *canonical.Canonicalizer
+	mutex         sync.Mutex
+	processed     map[string]interface{}
+	pending       map[string]parsers.DownloadArg
+}
+
+func NewTracker(canonicalizer *canonical.Canonicalizer) *Tracker {
+	return &Tracker{
+		Canonicalizer: canonicalizer,
+		mutex:         sync.Mutex{},
+		processed:     make(map[string]interface{}),
+		pending:       make(map[string]parsers.DownloadArg),
+	}
+}
+
+// Add registers download as pending until Done is called for its url.
+func (this *Tracker) Add(arg parsers.DownloadArg) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	key := this.Canonicalizer.Key(arg.Url)
+	if _, ok := this.processed[key]; ok {
+		return
+	}
+	if existing, ok := this.pending[key]; ok && existing.Depth <= arg.Depth {
+		return
+	}
+	this.pending[key] = arg
+}
+
+// Claim marks url as processed, returns false if it was already claimed before.
+func (this *Tracker) Claim(link url.URL) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	key := this.Canonicalizer.Key(link)
+	if _, ok := this.processed[key]; ok {
+		return false
+	}
+	this.processed[key] = 1
+	return true
+}
+
+// Done removes url from pending downloads, it is not part of the frontier anymore.
+func (this *Tracker) Done(link url.URL) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	delete(this.pending, this.Canonicalizer.Key(link))
+}
+
+func (this *Tracker) Snapshot(parseRoot string, urlToFile map[string]string, fileToUrl map[string]string, aliases map[string]Alias) State {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	frontier := make([]Entry, 0, len(this.pending))
+	for _, arg := range this.pending {
+		frontier = append(frontier, Entry{
+			Url:        arg.Url.String(),
+			IsRequired: arg.IsRequired,
+			FileName:   arg.FileName,
+			Depth:      arg.Depth,
+		})
+	}
+	visited := make([]string, 0, len(this.processed))
+	for url := range this.processed {
+		if _, ok := this.pending[url]; !ok {
+			visited = append(visited, url)
+		}
+	}
+	return State{
+		ParseRoot: parseRoot,
+		Frontier:  frontier,
+		Visited:   visited,
+		UrlToFile: urlToFile,
+		FileToUrl: fileToUrl,
+		Aliases:   aliases,
+	}
+}
+
+// Restore marks visited urls of the state as processed.
+func (this *Tracker) Restore(state State) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, url := range state.Visited {
+		this.processed[url] = 1
+	}
+}
+
+func Save(outputDir string, state State) error {
+	err := os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(outputDir, FileName)
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, content, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func Load(outputDir string) (State, error) {
+	content, err := os.ReadFile(filepath.Join(outputDir, FileName))
+	if err != nil {
+		return State{}, err
+	}
+	var state State
+	err = json.Unmarshal(content, &state)
+	return state, err
+}
@@ -0,0 +1,163 @@
+package summary
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/PatrikValkovic/scrappy/internal/download"
+)
+
+const (
+	CauseNetwork    = "network error"
+	CauseNoParser   = "no parser"
+	CauseProcessing = "processing failed"
+	CauseSaving     = "saving failed"
+)
+
+type Failure struct {
+	Url      string
+	Cause    string
+	Attempts uint32
+	Err      error
+}
+
+// Alias is a page that declared another page as canonical, its content is stored only under the canonical url.
+type Alias struct {
+	Url       string
+	Canonical string
+}
+
+// Skip is a download that was intentionally not stored, e.g. because of its size.
+type Skip struct {
+	Url    string
+	Reason string
+}
+
+type Summary struct {
+	mutex      sync.Mutex
+	failures   []Failure
+	aliases    []Alias
+	skipped    []Skip
+	rootFailed bool
+}
+
+func New() *Summary {
+	return &Summary{
+		mutex:    sync.Mutex{},
+		failures: make([]Failure, 0),
+		aliases:  make([]Alias, 0),
+		skipped:  make([]Skip, 0),
+	}
+}
+
+// DownloadCause categorizes download error by the HTTP status or as network error.
+func DownloadCause(err error) string {
+	var statusErr *download.StatusError
+	if errors.As(err, &statusErr) {
+		return fmt.Sprintf("HTTP %d", statusErr.StatusCode)
+	}
+	return CauseNetwork
+}
+
+func (this *Summary) Record(url string, cause string, err error, required bool) Failure {
+	attempts := uint32(1)
+	var attemptsErr *download.AttemptsError
+	if errors.As(err, &attemptsErr) {
+		attempts = attemptsErr.Attempts
+	}
+	failure := Failure{
+		Url:      url,
+		Cause:    cause,
+		Attempts: attempts,
+		Err:      err,
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.failures = append(this.failures, failure)
+	if required {
+		this.rootFailed = true
+	}
+	return failure
+}
+
+func (this *Summary) RootFailed() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.rootFailed
+}
+
+func (this *Summary) Failures() []Failure {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return append([]Failure{}, this.failures...)
+}
+
+func (this *Summary) RecordAlias(url string, canonical string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.aliases = append(this.aliases, Alias{Url: url, Canonical: canonical})
+}
+
+func (this *Summary) Aliases() []Alias {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return append([]Alias{}, this.aliases...)
+}
+
+func (this *Summary) RecordSkip(url string, reason string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.skipped = append(this.skipped, Skip{Url: url, Reason: reason})
+}
+
+func (this *Summary) Skipped() []Skip {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return append([]Skip{}, this.skipped...)
+}
+
+// Log prints aliases of canonical pages, skipped downloads and failed urls grouped by their cause.
+func (this *Summary) Log(logger *zap.SugaredLogger) {
+	aliases := this.Aliases()
+	if len(aliases) > 0 {
+		logger.Infof("%d pages were stored under their canonical url", len(aliases))
+		for _, alias := range aliases {
+			logger.Infof("    %s is alias of %s", alias.Url, alias.Canonical)
+		}
+	}
+	skipped := this.Skipped()
+	if len(skipped) > 0 {
+		logger.Infof("%d downloads were skipped", len(skipped))
+		for _, skip := range skipped {
+			logger.Infof("    %s: %s", skip.Url, skip.Reason)
+		}
+	}
+
+	failures := this.Failures()
+	if len(failures) == 0 {
+		logger.Infoln("Crawl finished without failures")
+		return
+	}
+
+	grouped := make(map[string][]Failure)
+	causes := make([]string, 0)
+	for _, failure := range failures {
+		if _, ok := grouped[failure.Cause]; !ok {
+			causes = append(causes, failure.Cause)
+		}
+		grouped[failure.Cause] = append(grouped[failure.Cause], failure)
+	}
+	sort.Strings(causes)
+
+	logger.Warnf("Crawl finished with %d failures", len(failures))
+	for _, cause := range causes {
+		logger.Warnf("%s: %d urls", cause, len(grouped[cause]))
+		for _, failure := range grouped[cause] {
+			logger.Warnf("    %s after %d attempts: %v", failure.Url, failure.Attempts, failure.Err)
+		}
+	}
+}
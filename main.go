@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/PatrikValkovic/scrappy/cmd"
@@ -8,7 +9,11 @@ import (
 
 func main() {
 	err := cmd.RootCmd.Execute()
+	var exitErr *cmd.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
 	if err != nil {
-		os.Exit(1)
+		os.Exit(cmd.ExitFailure)
 	}
 }
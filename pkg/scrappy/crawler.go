@@ -0,0 +1,817 @@
+// Package scrappy runs crawls in-process, the scrappy command is a thin wrapper over it.
+package scrappy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adrianbrad/queue"
+	"go.uber.org/zap"
+
+	"github.com/PatrikValkovic/scrappy/internal/config"
+	"github.com/PatrikValkovic/scrappy/internal/download"
+	"github.com/PatrikValkovic/scrappy/internal/fixup"
+	"github.com/PatrikValkovic/scrappy/internal/httpcache"
+	"github.com/PatrikValkovic/scrappy/internal/parsers"
+	"github.com/PatrikValkovic/scrappy/internal/ratelimit"
+	"github.com/PatrikValkovic/scrappy/internal/robots"
+	"github.com/PatrikValkovic/scrappy/internal/state"
+	"github.com/PatrikValkovic/scrappy/internal/summary"
+)
+
+// Options of the crawl, DefaultOptions returns the same defaults as the command line uses.
+type Options = config.Config
+
+type HostLimit = config.HostLimit
+
+type SizeLimit = config.SizeLimit
+
+type Failure = summary.Failure
+
+type Alias = summary.Alias
+
+type Skip = summary.Skip
+
+// Types needed to implement and register custom parsers.
+type (
+	Parser             = parsers.Parser
+	ParserRegistry     = parsers.Registry
+	ParserRegistration = parsers.Registration
+	ParserFactory      = parsers.Factory
+	DownloadArg        = parsers.DownloadArg
+	PathProcessor      = parsers.PathProcessor
+	ProcessedPath      = parsers.ProcessedPath
+)
+
+var (
+	ErrRootFailed     = errors.New("Root download failed")
+	ErrPartialFailure = errors.New("Some downloads failed")
+)
+
+func DefaultOptions() Options {
+	return config.Default()
+}
+
+type DownloadedPage struct {
+	Url url.URL
+	// FinalUrl differs from Url when the download was redirected.
+	FinalUrl    url.URL
+	FileName    string
+	ContentType string
+	// Content is nil for content streamed directly to disk.
+	Content     []byte
+	NotModified bool
+}
+
+type ParsedPage struct {
+	Url         url.URL
+	FileName    string
+	ContentType string
+	Links       []url.URL
+}
+
+// Crawler downloads pages according to Options. Callbacks are optional and may be called concurrently.
+type Crawler struct {
+	Options          Options
+	Logger           *zap.SugaredLogger
+	OnPageDownloaded func(page DownloadedPage)
+	OnPageParsed     func(page ParsedPage)
+	OnError          func(failure Failure)
+	// Parsers used for downloaded content, built-in parsers are registered by New.
+	Parsers *ParserRegistry
+
+	summary *summary.Summary
+}
+
+func New(options Options, logger *zap.SugaredLogger) (*Crawler, error) {
+	if options.RequiredPrefix == "" {
+		options.RequiredPrefix = options.ParseRoot
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+	return &Crawler{
+		Options: options,
+		Logger:  logger,
+		Parsers: parsers.NewDefaultRegistry(),
+		summary: summary.New(),
+	}, nil
+}
+
+// Failures returns downloads that failed during the last Run.
+func (this *Crawler) Failures() []Failure {
+	return this.summary.Failures()
+}
+
+// Skipped returns downloads of the last Run that were intentionally not stored.
+func (this *Crawler) Skipped() []Skip {
+	return this.summary.Skipped()
+}
+
+// Aliases returns pages of the last Run that were stored under their canonical url.
+func (this *Crawler) Aliases() []Alias {
+	return this.summary.Aliases()
+}
+
+// Run crawls until all reachable pages are processed or ctx is cancelled.
+// Returns ErrRootFailed or ErrPartialFailure when some of the downloads failed.
+func (this *Crawler) Run(ctx context.Context) error {
+	var err error
+	options := this.Options
+	args := &options
+	logger := this.Logger
+	logger.Infof("Starting download loop for %s", args.ParseRoot)
+
+	downloadQueue := queue.NewLinked([]parsers.DownloadArg{})
+	downloadSignal := make(chan struct{}, 1)
+	parseQueue := make(chan *parsers.ParseArg, 4*int(args.ParseConcurrency))
+	interruptCtx := ctx
+	endCtx, endProgram := context.WithCancel(context.Background())
+	defer endProgram()
+	prefixUrl, err := url.Parse(args.RequiredPrefix)
+	if err != nil {
+		return fmt.Errorf("Could not parse prefix url %s: %v", args.RequiredPrefix, err)
+	}
+	pathProcessor := parsers.NewPathProcessor(logger, prefixUrl, args)
+	// Links are canonicalized by the path processor, so the prefix must be canonical as well
+	canonicalPrefix := pathProcessor.Canonicalizer.Url(*prefixUrl)
+	args.RequiredPrefix = canonicalPrefix.String()
+	pathProcessor.Location = &canonicalPrefix
+	downloadClient := download.NewClient(args, logger)
+	// robots.txt is fetched by own client, so that exclusions, size limits and sniffing of pages do not apply to it
+	robotsClient := download.NewClient(args, logger)
+	robotsClient.MaxSizes = nil
+	robotsClient.Sniffer = nil
+	robotsChecker := robots.NewChecker(logger, robotsClient, args.UserAgent, args.IgnoreRobots)
+	hostLimiter := ratelimit.NewLimiter(args.HostDefaultLimit, args.HostLimits)
+	binaryPolicy := parsers.NewBinaryPolicy(args)
+
+	tracker := state.NewTracker(pathProcessor.Canonicalizer)
+	var cacheStore *httpcache.Store
+	if args.ConditionalRequests {
+		cacheStore, err = httpcache.Load(args.OutputDir)
+		if err != nil {
+			logger.Warnf("Could not load cache of previous crawl: %v", err)
+			cacheStore = nil
+		}
+	}
+	this.summary = summary.New()
+	// Files whose content was rewritten by a parser, they may contain links to files that are never written
+	documents := make([]string, 0)
+	documentsMutex := sync.Mutex{}
+	recordFailure := func(link url.URL, cause string, err error, required bool) {
+		failure := this.summary.Record(link.String(), cause, err, required)
+		if this.OnError != nil {
+			this.OnError(failure)
+		}
+	}
+
+	// Number of downloads that were enqueued and were not fully processed yet, the crawl ends when it drops to zero
+	inFlight := int64(0)
+	notifyDownloaders := func() {
+		select {
+		case downloadSignal <- struct{}{}:
+		default:
+		}
+	}
+	enqueue := func(downloadArg parsers.DownloadArg) error {
+		if downloadArg.Depth > args.MaxDepth {
+			logger.Debugf("Skipping %s because of depth", downloadArg.Url.String())
+			return nil
+		}
+		tracker.Add(downloadArg)
+		atomic.AddInt64(&inFlight, 1)
+		if err := downloadQueue.Offer(downloadArg); err != nil {
+			atomic.AddInt64(&inFlight, -1)
+			return err
+		}
+		notifyDownloaders()
+		return nil
+	}
+	finish := func() {
+		if atomic.AddInt64(&inFlight, -1) == 0 {
+			logger.Infoln("All downloaders and parsers finished")
+			endProgram()
+		}
+	}
+	checkpoint := func() {
+		aliases := make(map[string]state.Alias)
+		for alias, canonical := range pathProcessor.Aliases() {
+			aliases[alias] = state.Alias{Url: canonical.Url.String(), FileName: canonical.LocalPath}
+		}
+		snapshot := tracker.Snapshot(args.ParseRoot, pathProcessor.Mappings(), pathProcessor.Files(), aliases)
+		if err := state.Save(args.OutputDir, snapshot); err != nil {
+			logger.Warnf("Could not save crawl state: %v", err)
+			return
+		}
+		logger.Debugf("Crawl state saved, %d downloads remaining", len(snapshot.Frontier))
+		if cacheStore != nil {
+			if err := cacheStore.Save(); err != nil {
+				logger.Warnf("Could not save cache: %v", err)
+			}
+		}
+	}
+	// streamable content is stored without changes, so it does not need to be kept in memory
+	streamable := func(location url.URL, contentType string) bool {
+		registration, found := this.Parsers.Find(contentType, location)
+		if !found {
+			return binaryPolicy.Allows(contentType)
+		}
+		return registration.Streamable
+	}
+	// Excluded types without a parser are dropped before their body is downloaded
+	downloadClient.Excluded = func(location url.URL, contentType string) bool {
+		_, found := this.Parsers.Find(contentType, location)
+		return !found && binaryPolicy.Excludes(contentType)
+	}
+	// conditionalDownload returns true when the streamed file was not modified and is already in place
+	conditionalDownload := func(downloadArg parsers.DownloadArg) (download.DownloadResult, bool, error) {
+		if cacheStore == nil {
+			response, err := downloadClient.DownloadTo(interruptCtx, downloadArg.Url, download.Validators{}, streamable)
+			return response, false, err
+		}
+		key := downloadArg.Url.String()
+		validators := download.Validators{}
+		if entry, ok := cacheStore.Get(key); ok {
+			validators = download.Validators{ETag: entry.ETag, LastModified: entry.LastModified}
+		}
+		response, err := downloadClient.DownloadTo(interruptCtx, downloadArg.Url, validators, streamable)
+		if err != nil {
+			return response, false, err
+		}
+		if entry, ok := cacheStore.Get(key); ok && response.NotModified && entry.Raw == "" && streamable(response.Url, entry.ContentType) {
+			localPath := filepath.Join(args.OutputDir, entry.FileName)
+			if _, err := os.Stat(localPath); err == nil && entry.FileName == downloadArg.FileName && len(response.Redirects) == 0 {
+				logger.Infof("Not modified %s, keeping %s", key, entry.FileName)
+				return response, true, nil
+			}
+			tempFile, err := copyToTemp(args.OutputDir, localPath)
+			if err == nil {
+				logger.Infof("Not modified %s, reusing local copy", key)
+				response.TempFile = tempFile
+				response.ContentType = entry.ContentType
+				return response, false, nil
+			}
+			logger.Warnf("Could not reuse local copy of %s: %v", key, err)
+			response, err = downloadClient.DownloadTo(interruptCtx, downloadArg.Url, download.Validators{}, streamable)
+			return response, false, err
+		}
+		if response.NotModified {
+			content, entry, err := cacheStore.Content(key)
+			if err == nil {
+				logger.Infof("Not modified %s, reusing local copy", key)
+				response.Content = content
+				response.ContentType = entry.ContentType
+				return response, false, nil
+			}
+			logger.Warnf("Could not reuse local copy of %s: %v", key, err)
+			response, err = downloadClient.DownloadTo(interruptCtx, downloadArg.Url, download.Validators{}, streamable)
+			return response, false, err
+		}
+		return response, false, nil
+	}
+	// storeStreamed moves streamed download into its file, streamed content is never parsed
+	storeStreamed := func(downloadArg parsers.DownloadArg, requestUrl url.URL, response download.DownloadResult) {
+		err := moveFile(response.TempFile, filepath.Join(args.OutputDir, downloadArg.FileName))
+		if err != nil {
+			_ = os.Remove(response.TempFile)
+			logger.Warnf("Error saving %s: %v", downloadArg.Url.String(), err)
+			recordFailure(downloadArg.Url, summary.CauseSaving, err, downloadArg.IsRequired)
+			return
+		}
+		logger.Infof("Stored %s into %s", downloadArg.Url.String(), downloadArg.FileName)
+		if cacheStore != nil {
+			cacheStore.Put(requestUrl.String(), httpcache.Entry{
+				ETag:         response.ETag,
+				LastModified: response.LastModified,
+				ContentType:  response.ContentType,
+				FileName:     downloadArg.FileName,
+			})
+		}
+		if this.OnPageParsed != nil {
+			this.OnPageParsed(ParsedPage{
+				Url:         downloadArg.Url,
+				FileName:    downloadArg.FileName,
+				ContentType: response.ContentType,
+				Links:       []url.URL{},
+			})
+		}
+	}
+	// followRedirect stores the content under the file of the final url, the requested url becomes its alias.
+	// Returns false when the final url was already processed.
+	followRedirect := func(source parsers.DownloadArg, response download.DownloadResult) (parsers.DownloadArg, bool) {
+		target := source
+		target.Url = response.Url
+		logger.Infof("%s redirected to %s", source.Url.String(), response.Url.String())
+		canonicalTarget := pathProcessor.Canonicalizer.Url(response.Url)
+		if !strings.HasPrefix(canonicalTarget.String(), args.RequiredPrefix) && source.IsRequired && source.Depth == 0 {
+			// Root redirected e.g. from http to https, nothing else is crawled yet, so the prefix can be moved
+			rebased := *pathProcessor.Location
+			rebased.Scheme = canonicalTarget.Scheme
+			rebased.Host = canonicalTarget.Host
+			if strings.HasPrefix(canonicalTarget.String(), rebased.String()) {
+				logger.Warnf("Root redirected to %s, using required prefix %s instead of %s", response.Url.String(), rebased.String(), args.RequiredPrefix)
+				args.RequiredPrefix = rebased.String()
+				pathProcessor.SetLocation(&rebased)
+				// The root keeps its file instead of becoming a redirect
+				pathProcessor.Assign(response.Url, source.FileName)
+			}
+		}
+		if !strings.HasPrefix(canonicalTarget.String(), args.RequiredPrefix) {
+			// Links are still resolved against the final url, children outside of the prefix are filtered by the parsers
+			logger.Warnf("Redirect target %s does not have required prefix %s, storing into %s", response.Url.String(), args.RequiredPrefix, source.FileName)
+			return target, true
+		}
+		processed := pathProcessor.HandlePath(response.Url.String(), response.Url, filepath.Dir(source.FileName))
+		if !processed.Success || processed.LocalPath == source.FileName {
+			return target, true
+		}
+		target.FileName = processed.LocalPath
+		for _, redirected := range response.Redirects {
+			pathProcessor.Alias(redirected, processed)
+		}
+		mediaType := parsers.MediaType(response.ContentType)
+		if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+			err := fixup.WriteRedirect(args.OutputDir, source.FileName, processed.RelativeTo(source.FileName))
+			if err != nil {
+				logger.Warnf("Could not write redirect from %s to %s: %v", source.FileName, processed.LocalPath, err)
+			}
+		}
+		if !tracker.Claim(response.Url) {
+			logger.Infof("Redirect target %s is already processed", response.Url.String())
+			return target, false
+		}
+		tracker.Done(response.Url)
+		return target, true
+	}
+
+	if args.Resume {
+		// Resume from the checkpoint of previous run
+		previous, err := state.Load(args.OutputDir)
+		if err != nil {
+			return fmt.Errorf("Could not load crawl state from %s: %v", args.OutputDir, err)
+		}
+		if previous.ParseRoot != args.ParseRoot {
+			return fmt.Errorf("Crawl state was created for %s, not %s", previous.ParseRoot, args.ParseRoot)
+		}
+		pathProcessor.Restore(previous.UrlToFile, previous.FileToUrl)
+		for alias, canonical := range previous.Aliases {
+			aliasUrl, aliasErr := url.Parse(alias)
+			canonicalUrl, canonicalErr := url.Parse(canonical.Url)
+			if aliasErr != nil || canonicalErr != nil {
+				logger.Warnf("Could not restore alias %s of %s", alias, canonical.Url)
+				continue
+			}
+			pathProcessor.Alias(*aliasUrl, parsers.ProcessedPath{Success: true, Url: *canonicalUrl, LocalPath: canonical.FileName})
+		}
+		for fileName := range pathProcessor.Files() {
+			extension := filepath.Ext(fileName)
+			if extension != ".html" && extension != ".htm" && extension != ".css" {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(args.OutputDir, fileName)); err == nil {
+				documents = append(documents, fileName)
+			}
+		}
+		tracker.Restore(previous)
+		for _, entry := range previous.Frontier {
+			downloadArg, err := parsers.NewDownloadArg(entry.Url, entry.IsRequired, entry.FileName, logger, entry.Depth)
+			if err != nil {
+				logger.Warnf("Could not restore download %s: %v", entry.Url, err)
+				continue
+			}
+			if err = enqueue(downloadArg); err != nil {
+				logger.Warnf("Error inserting download into queue: %s", err)
+			}
+		}
+		logger.Infof("Resuming crawl with %d visited and %d remaining urls", len(previous.Visited), len(previous.Frontier))
+	} else {
+		// Root download
+		processedRoot := pathProcessor.HandlePath(args.ParseRoot, *prefixUrl, ".")
+		if !processedRoot.Success {
+			return fmt.Errorf("%w: could not parse root url %s", ErrRootFailed, args.ParseRoot)
+		}
+		rootUrl := processedRoot.Url
+		rootUrl.Fragment = ""
+		rootDownloadArg, rootDownloadError := parsers.NewDownloadArg(
+			rootUrl.String(),
+			true,
+			processedRoot.LocalPath,
+			logger,
+			0,
+		)
+		if rootDownloadError != nil {
+			return fmt.Errorf("%w: could not parse root url %s: %v", ErrRootFailed, args.ParseRoot, rootDownloadError)
+		}
+		err = enqueue(rootDownloadArg)
+		if err != nil {
+			return fmt.Errorf("%w: could not insert root url %s into queue: %v", ErrRootFailed, args.ParseRoot, err)
+		}
+	}
+
+	// Checkpoints
+	go func() {
+		if args.CheckpointInterval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(args.CheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-endCtx.Done():
+				return
+			case <-interruptCtx.Done():
+				return
+			case <-ticker.C:
+				checkpoint()
+			}
+		}
+	}()
+
+	if atomic.LoadInt64(&inFlight) == 0 {
+		logger.Infoln("Nothing to download")
+		endProgram()
+	}
+
+	// Downloads
+	downloadPool := sync.WaitGroup{}
+	for i := uint32(0); i < args.DownloadConcurrency; i++ {
+		downloadPool.Add(1)
+		go func() {
+			defer downloadPool.Done()
+			for {
+				downloadArg, err := downloadQueue.Get()
+				if err != nil {
+					select {
+					case <-endCtx.Done():
+						return
+					case <-interruptCtx.Done():
+						logger.Debugln("Downloader interrupted")
+						return
+					case <-downloadSignal:
+						continue
+					}
+				}
+				if !downloadQueue.IsEmpty() {
+					notifyDownloaders()
+				}
+
+				if !tracker.Claim(downloadArg.Url) {
+					logger.Debugf("Skipping %s because of already processed", downloadArg.Url.String())
+					finish()
+					continue
+				}
+
+				allowed, err := robotsChecker.Allowed(interruptCtx, downloadArg.Url)
+				if err != nil {
+					return
+				}
+				if !allowed {
+					logger.Infof("Skipping %s because it is disallowed by robots.txt", downloadArg.Url.String())
+					tracker.Done(downloadArg.Url)
+					finish()
+					continue
+				}
+				releaseHost, err := hostLimiter.Acquire(interruptCtx, downloadArg.Url.Hostname())
+				if err != nil {
+					return
+				}
+				if err = robotsChecker.Wait(interruptCtx, downloadArg.Url); err != nil {
+					releaseHost()
+					return
+				}
+
+				logger.Infof("Downloading %s, remaining: %d", downloadArg.Url.String(), downloadQueue.Size())
+				response, upToDate, err := conditionalDownload(downloadArg)
+				releaseHost()
+				if err != nil && interruptCtx.Err() != nil {
+					return
+				}
+				var sizeErr *download.SizeError
+				if errors.As(err, &sizeErr) {
+					logger.Infof("Skipping %s: %v", downloadArg.Url.String(), sizeErr)
+					this.summary.RecordSkip(downloadArg.Url.String(), sizeErr.Error())
+					tracker.Done(downloadArg.Url)
+					finish()
+					continue
+				}
+				var excludedErr *download.ExcludedError
+				if errors.As(err, &excludedErr) {
+					logger.Infof("Skipping %s: %v", downloadArg.Url.String(), excludedErr)
+					this.summary.RecordSkip(downloadArg.Url.String(), excludedErr.Error())
+					tracker.Done(downloadArg.Url)
+					finish()
+					continue
+				}
+				if err != nil {
+					logger.Warnf("Error downloading %s: %s", downloadArg.Url.String(), err)
+					recordFailure(downloadArg.Url, summary.DownloadCause(err), err, downloadArg.IsRequired)
+					tracker.Done(downloadArg.Url)
+					finish()
+					continue
+				}
+				if upToDate {
+					tracker.Done(downloadArg.Url)
+					finish()
+					continue
+				}
+				logger.Debugf("Downloaded %s", response.ContentType)
+
+				if this.OnPageDownloaded != nil {
+					this.OnPageDownloaded(DownloadedPage{
+						Url:         downloadArg.Url,
+						FinalUrl:    response.Url,
+						FileName:    downloadArg.FileName,
+						ContentType: response.ContentType,
+						Content:     response.Content,
+						NotModified: response.NotModified,
+					})
+				}
+
+				parseArg := parsers.NewParseArg(downloadArg, response.Content, response.ContentType)
+				if len(response.Redirects) > 0 {
+					target, isNew := followRedirect(downloadArg, response)
+					if !isNew {
+						if response.TempFile != "" {
+							_ = os.Remove(response.TempFile)
+						}
+						tracker.Done(downloadArg.Url)
+						finish()
+						continue
+					}
+					parseArg.DownloadArg = target
+				}
+				if response.TempFile != "" {
+					storeStreamed(parseArg.DownloadArg, downloadArg.Url, response)
+					tracker.Done(downloadArg.Url)
+					finish()
+					continue
+				}
+				parseArg.ETag = response.ETag
+				parseArg.LastModified = response.LastModified
+				select {
+				case parseQueue <- &parseArg:
+				case <-interruptCtx.Done():
+					logger.Debugln("Downloader interrupted")
+					return
+				}
+			}
+		}()
+	}
+
+	// Parsers
+	parsePool := sync.WaitGroup{}
+	for i := uint32(0); i < args.ParseConcurrency; i++ {
+		parsePool.Add(1)
+		go func() {
+			defer parsePool.Done()
+			for {
+				var toParse *parsers.ParseArg
+				select {
+				case <-endCtx.Done():
+					return
+				case <-interruptCtx.Done():
+					logger.Debugln("Parser interrupted")
+					return
+				case toParse = <-parseQueue:
+				}
+				parser := this.Parsers.Get(toParse.ContentType, toParse.DownloadArg.Url, logger, args, pathProcessor)
+				if parser == nil && binaryPolicy.Excludes(toParse.ContentType) {
+					logger.Infof("Skipping %s because content type %s is excluded", toParse.DownloadArg.Url.String(), toParse.ContentType)
+					this.summary.RecordSkip(toParse.DownloadArg.Url.String(), fmt.Sprintf("Content type %s is excluded", toParse.ContentType))
+					tracker.Done(toParse.RequestUrl)
+					finish()
+					continue
+				}
+				if parser == nil && binaryPolicy.Allows(toParse.ContentType) {
+					parser = &parsers.PassthroughParser{}
+				}
+				if parser == nil {
+					logger.Warnf("No parser found for %s", toParse.ContentType)
+					recordFailure(
+						toParse.DownloadArg.Url,
+						summary.CauseNoParser,
+						fmt.Errorf("Unsupported content type %s", toParse.ContentType),
+						toParse.DownloadArg.IsRequired,
+					)
+					tracker.Done(toParse.RequestUrl)
+					finish()
+					continue
+				}
+
+				body, encoding, err := parsers.DecodeText(toParse.Body, toParse.ContentType)
+				if err != nil {
+					logger.Warnf("Could not decode %s from %s: %v", toParse.DownloadArg.Url.String(), encoding, err)
+				} else if encoding != "" && encoding != "utf-8" {
+					logger.Debugf("Decoded %s from %s", toParse.DownloadArg.Url.String(), encoding)
+				}
+				result, toProcess, err := parser.Process(body, toParse.DownloadArg)
+				if err != nil {
+					logger.Warnf("Error processing %s: %s", toParse.ContentType, err)
+					recordFailure(toParse.DownloadArg.Url, summary.CauseProcessing, err, toParse.DownloadArg.IsRequired)
+					tracker.Done(toParse.RequestUrl)
+					finish()
+					continue
+				}
+				logger.Infof("Processed %s, returned %d new downloads", toParse.DownloadArg.Url.String(), len(toProcess))
+				fileName := toParse.DownloadArg.FileName
+				store := true
+				if canonical, isAlias := pathProcessor.CanonicalOf(toParse.DownloadArg.Url); isAlias {
+					this.summary.RecordAlias(toParse.DownloadArg.Url.String(), canonical.Url.String())
+					fileName = canonical.LocalPath
+					if tracker.Claim(canonical.Url) {
+						tracker.Done(canonical.Url)
+					} else {
+						logger.Infof("Not storing %s, its canonical page %s is already processed", toParse.DownloadArg.Url.String(), canonical.Url.String())
+						store = false
+					}
+				}
+				if store {
+					err = saveFile(filepath.Join(args.OutputDir, fileName), logger, result)
+					if err == nil && !bytes.Equal(result, toParse.Body) {
+						documentsMutex.Lock()
+						documents = append(documents, fileName)
+						documentsMutex.Unlock()
+					}
+					if err != nil {
+						logger.Warnf("Error saving %s: %v", toParse.DownloadArg.Url.String(), err)
+						recordFailure(toParse.DownloadArg.Url, summary.CauseSaving, err, toParse.DownloadArg.IsRequired)
+					} else if cacheStore != nil {
+						cacheStore.Put(toParse.RequestUrl.String(), httpcache.Entry{
+							ETag:         toParse.ETag,
+							LastModified: toParse.LastModified,
+							ContentType:  toParse.ContentType,
+							FileName:     fileName,
+						})
+						if !bytes.Equal(result, toParse.Body) {
+							err := cacheStore.SaveRaw(toParse.RequestUrl.String(), toParse.Body)
+							if err != nil {
+								logger.Warnf("Could not cache original content of %s: %v", toParse.DownloadArg.Url.String(), err)
+							}
+						}
+					}
+				}
+				if this.OnPageParsed != nil {
+					links := make([]url.URL, 0, len(toProcess))
+					for _, downloadArg := range toProcess {
+						links = append(links, downloadArg.Url)
+					}
+					this.OnPageParsed(ParsedPage{
+						Url:         toParse.DownloadArg.Url,
+						FileName:    fileName,
+						ContentType: toParse.ContentType,
+						Links:       links,
+					})
+				}
+				for _, downloadArg := range toProcess {
+					err := enqueue(downloadArg)
+					if err != nil {
+						logger.Warnf("Error inserting download into queue: %s", err)
+					}
+				}
+				tracker.Done(toParse.RequestUrl)
+				finish()
+			}
+		}()
+	}
+
+	parsePool.Wait()
+	downloadPool.Wait()
+	endProgram()
+	checkpoint()
+	leftovers, _ := filepath.Glob(filepath.Join(args.OutputDir, download.TempPattern))
+	for _, leftover := range leftovers {
+		_ = os.Remove(leftover)
+	}
+	if ctx.Err() == nil {
+		fixMissingLinks(args, logger, pathProcessor, documents)
+	}
+
+	this.summary.Log(logger)
+	switch {
+	case this.summary.RootFailed():
+		return ErrRootFailed
+	case len(this.summary.Failures()) > 0:
+		return ErrPartialFailure
+	}
+	return ctx.Err()
+}
+
+// fixMissingLinks rewrites links to files that were never written, e.g. because of depth or failed download,
+// to the canonical page, to the placeholder or back to the original url.
+func fixMissingLinks(args *config.Config, logger *zap.SugaredLogger, pathProcessor *parsers.PathProcessor, documents []string) {
+	missing := make(map[string]fixup.Target)
+	for fileName, link := range pathProcessor.Files() {
+		if _, err := os.Stat(filepath.Join(args.OutputDir, fileName)); err == nil {
+			continue
+		}
+		parsedUrl, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		if canonical, isAlias := pathProcessor.CanonicalOf(*parsedUrl); isAlias {
+			if _, err := os.Stat(filepath.Join(args.OutputDir, canonical.LocalPath)); err == nil {
+				missing[fileName] = fixup.Target{File: canonical.LocalPath}
+				continue
+			}
+		}
+		if args.MissingPlaceholder != "" {
+			missing[fileName] = fixup.Target{File: args.MissingPlaceholder}
+		} else {
+			missing[fileName] = fixup.Target{Url: link}
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	if args.MissingPlaceholder != "" {
+		if err := fixup.WritePlaceholder(args.OutputDir, args.MissingPlaceholder); err != nil {
+			logger.Warnf("Could not write placeholder %s: %v", args.MissingPlaceholder, err)
+		}
+	}
+
+	fixer := fixup.Fixer{Logger: logger, OutputDir: args.OutputDir, Missing: missing}
+	rewritten := 0
+	for _, fileName := range documents {
+		count, err := fixer.Fix(fileName)
+		if err != nil {
+			logger.Warnf("Could not fix links in %s: %v", fileName, err)
+		}
+		rewritten += count
+	}
+	logger.Infof("Rewrote %d links to %d files that were not downloaded", rewritten, len(missing))
+}
+
+func moveFile(from string, to string) error {
+	err := os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return fmt.Errorf("Could not create output directory %s because of %v", filepath.Dir(to), err)
+	}
+	return os.Rename(from, to)
+}
+
+// copyToTemp copies file into new temporary file in the directory, the content is not loaded into memory.
+func copyToTemp(directory string, path string) (_ string, err error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	target, err := os.CreateTemp(directory, download.TempPattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(target, source)
+	closeErr := target.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(target.Name())
+		return "", err
+	}
+	return target.Name(), nil
+}
+
+func saveFile(path string, logger *zap.SugaredLogger, content []byte) (err error) {
+	outputDir := filepath.Dir(path)
+	_, err = os.ReadDir(outputDir)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(outputDir, 0755)
+		if err != nil {
+			return fmt.Errorf("Could not create output directory %s because of %v", outputDir, err)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Could not create file %s because of %v", path, err)
+	}
+	defer func() {
+		closeErr := file.Close()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("Error closing file %s because of %v", path, closeErr)
+		}
+	}()
+	written, err := file.Write(content)
+	logger.Debugf("Written %d bytes", written)
+	if err != nil {
+		return fmt.Errorf("Could not write to file %s because of %v", path, err)
+	}
+
+	logger.Debugf("Data written into %s", path)
+	return nil
+}